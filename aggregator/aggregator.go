@@ -0,0 +1,345 @@
+package aggregator
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/app"
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
+	"accessAggregator/internal/tailer"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+type (
+	// Record is one parsed access log line.
+	Record = accesslog.Record
+	// Summarizer accumulates raw records and renders them as a table.
+	Summarizer = accesslog.Summarizer
+	// Clock is the time source of a pipeline, see WithClock.
+	Clock = clock.Clock
+	// FakeClock only moves when advanced, for tests of code built on top.
+	FakeClock = clock.Fake
+	// Snapshot is the structured form of one tick.
+	Snapshot = sink.Snapshot
+	// Row is one host of a Snapshot.
+	Row = accesslog.Row
+	// Sink receives a Snapshot on every tick, see WithSink.
+	Sink = sink.Sink
+	// Framing joins the lines of a source into multiline records, see
+	// WithFraming.
+	Framing = tailer.FramerOptions
+	// StartPosition is where WithFile sources start, see
+	// ParseStartPosition.
+	StartPosition = tailer.StartPosition
+)
+
+const (
+	// FrameJSON makes a record of every brace balanced JSON object.
+	FrameJSON = tailer.FrameJSON
+	// FramePattern starts a record at every line matching Framing.Start.
+	FramePattern = tailer.FramePattern
+)
+
+func NewRecord(rawRecord []byte) (*Record, error) { return accesslog.NewRecord(rawRecord) }
+
+// NewSummarizer returns the single goroutine per-host summarizer the
+// pipeline uses by default.
+func NewSummarizer() Summarizer {
+	a, _ := accesslog.NewAggregator(accesslog.Options{}) // zero options are valid
+	return a
+}
+
+func NewFakeClock(now time.Time) *FakeClock { return clock.NewFake(now) }
+
+// ParseStartPosition reads end, beginning, offset:BYTES, lines:N or
+// time:RFC3339.
+func ParseStartPosition(s string) (StartPosition, error) { return tailer.ParseStartPosition(s) }
+
+// Tick is handed to OnTick callbacks after every summary.
+type Tick struct {
+	Time  time.Time
+	Final bool // the summary printed on shutdown
+	// Summary is only safe to use during the callback.
+	Summary Summarizer
+	// Snapshot holds the same data as plain values, safe to keep.
+	Snapshot Snapshot
+}
+
+// Pipeline tails its sources and aggregates them until Run returns.
+type Pipeline struct {
+	flags  config.Flags
+	inputs []app.Input
+	names  map[string]bool
+	clk    Clock
+	onTick []func(Tick)
+	sinks  map[string]sink.Sink
+	out    io.Writer
+	errOut io.Writer
+	log    *slog.Logger
+}
+
+type Option func(*Pipeline) error
+
+// New builds a pipeline. Output goes to io.Discard and errors to os.Stderr
+// unless WithOutput and WithErrorOutput say otherwise.
+func New(opts ...Option) (*Pipeline, error) {
+	p := &Pipeline{
+		flags: config.Flags{
+			Interval:   10 * time.Second,
+			Workers:    1,
+			SampleRate: 1,
+		},
+		names:  map[string]bool{},
+		clk:    clock.Real{},
+		out:    io.Discard,
+		errOut: os.Stderr,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if len(p.inputs) == 0 {
+		return nil, errors.New("aggregator: no sources, use WithFile or WithSource")
+	}
+	if p.flags.Replay && len(p.inputs) > 1 {
+		return nil, errors.New("aggregator: WithReplay takes a single source")
+	}
+	return p, nil
+}
+
+// Run blocks until ctx is done or every source is exhausted, then emits the
+// final summary.
+func (p *Pipeline) Run(ctx context.Context) error {
+	var onTick app.TickFunc
+	if len(p.onTick) > 0 {
+		onTick = func(snap sink.Snapshot, summaries accesslog.Summarizer) {
+			for _, fn := range p.onTick {
+				fn(Tick{Time: snap.Time, Final: snap.Final, Summary: summaries, Snapshot: snap})
+			}
+		}
+	}
+	return app.RunWithOptions(ctx, p.flags, app.Options{
+		Clock:  p.clk,
+		Inputs: p.inputs,
+		OnTick: onTick,
+		Sinks:  p.sinks,
+		Logger: p.log,
+	}, p.out, p.errOut)
+}
+
+func (p *Pipeline) addInput(name string, open func(log *slog.Logger) (tailer.Tailer, error)) error {
+	if p.names[name] {
+		return fmt.Errorf("aggregator: duplicate source %q", name)
+	}
+	p.names[name] = true
+	p.inputs = append(p.inputs, app.Input{Name: name, Open: open})
+	return nil
+}
+
+// WithFile tails the file at path, following truncation and rename
+// rotations.
+func WithFile(path string) Option {
+	return func(p *Pipeline) error {
+		return p.addInput(path, app.FileOpener(path, func() tailer.Options {
+			start := p.flags.Start
+			if p.flags.Replay && start.Kind == tailer.StartDefault {
+				start.Kind = tailer.StartBeginning
+			}
+			opts := tailer.Options{
+				FromStart:   p.flags.FromStart,
+				Start:       start,
+				TimeOf:      app.RecordTime,
+				Clock:       p.clk,
+				MaxLineSize: p.flags.MaxLineSize,
+			}
+			if p.flags.WaitForFiles {
+				opts.Retry = &p.flags.Retry
+			}
+			return opts
+		}))
+	}
+}
+
+// WithSource adds a custom source, name identifies it in error output.
+func WithSource(name string, src Source) Option {
+	return func(p *Pipeline) error {
+		if src == nil {
+			return fmt.Errorf("aggregator: nil source %q", name)
+		}
+		return p.addInput(name, func(*slog.Logger) (tailer.Tailer, error) {
+			if l, ok := src.(lineLimiter); ok {
+				l.setMaxLineSize(p.flags.MaxLineSize)
+			}
+			return src, nil
+		})
+	}
+}
+
+// WithFromStart makes WithFile sources read from the beginning of the file
+// instead of only new lines.
+func WithFromStart(fromStart bool) Option {
+	return func(p *Pipeline) error {
+		p.flags.FromStart = fromStart
+		return nil
+	}
+}
+
+// WithWaitForFiles makes every source retry opening with exponential backoff
+// from initial up to max instead of failing, and WithFile sources survive
+// their file disappearing or failing to reopen.
+func WithWaitForFiles(initial, max time.Duration) Option {
+	return func(p *Pipeline) error {
+		if initial <= 0 || max < initial {
+			return fmt.Errorf("aggregator: invalid retry backoff %v to %v", initial, max)
+		}
+		p.flags.WaitForFiles = true
+		p.flags.Retry = tailer.Retry{Initial: initial, Max: max}
+		return nil
+	}
+}
+
+// WithFraming joins the lines of the source called name, added by an
+// earlier WithFile or WithSource, into multiline records.
+func WithFraming(name string, f Framing) Option {
+	return func(p *Pipeline) error {
+		if f.Framing == FramePattern && f.Start == nil {
+			return fmt.Errorf("aggregator: pattern framing of %q needs Start", name)
+		}
+		for i := range p.inputs {
+			if p.inputs[i].Name == name {
+				p.inputs[i].Framing = f
+				return nil
+			}
+		}
+		return fmt.Errorf("aggregator: no source %q to frame", name)
+	}
+}
+
+// WithMaxLineSize makes WithFile and ReaderSource sources skip and count
+// lines longer than n bytes instead of buffering them whole.
+func WithMaxLineSize(n int) Option {
+	return func(p *Pipeline) error {
+		if n < 1 {
+			return fmt.Errorf("aggregator: invalid max line size %d", n)
+		}
+		p.flags.MaxLineSize = n
+		return nil
+	}
+}
+
+// WithStartPosition makes WithFile sources start at pos, overriding
+// WithFromStart.
+func WithStartPosition(pos StartPosition) Option {
+	return func(p *Pipeline) error {
+		p.flags.Start = pos
+		return nil
+	}
+}
+
+// WithReplay reads the single source up to its current end, paced by record
+// times at speed times real time, 0 for as fast as possible. Summaries are
+// taken on record time, as they would have been live. A WithFile source
+// starts at the beginning unless WithStartPosition says otherwise.
+func WithReplay(speed float64) Option {
+	return func(p *Pipeline) error {
+		if speed < 0 {
+			return fmt.Errorf("aggregator: invalid replay speed %v", speed)
+		}
+		p.flags.Replay, p.flags.ReplaySpeed = true, speed
+		return nil
+	}
+}
+
+func WithInterval(d time.Duration) Option {
+	return func(p *Pipeline) error {
+		if d <= 0 {
+			return fmt.Errorf("aggregator: invalid interval %v", d)
+		}
+		p.flags.Interval = d
+		return nil
+	}
+}
+
+// WithWorkers parses and aggregates on n goroutines, sharded by host.
+func WithWorkers(n int) Option {
+	return func(p *Pipeline) error {
+		if n < 1 {
+			return fmt.Errorf("aggregator: invalid workers %d", n)
+		}
+		p.flags.Workers = n
+		return nil
+	}
+}
+
+// WithDistinctField adds a per-host unique count of field, e.g. client_ip.
+func WithDistinctField(field string) Option {
+	return func(p *Pipeline) error {
+		p.flags.DistinctField = field
+		return nil
+	}
+}
+
+func WithClock(clk Clock) Option {
+	return func(p *Pipeline) error {
+		p.clk = clk
+		return nil
+	}
+}
+
+// WithOutput receives the human readable summary tables.
+func WithOutput(w io.Writer) Option {
+	return func(p *Pipeline) error {
+		p.out = w
+		return nil
+	}
+}
+
+// WithErrorOutput receives per-source errors and other diagnostics as slog
+// text lines, unless WithLogger is set.
+func WithErrorOutput(w io.Writer) Option {
+	return func(p *Pipeline) error {
+		p.errOut = w
+		return nil
+	}
+}
+
+// WithLogger receives per-source errors, rotations and shutdown events
+// instead of WithErrorOutput.
+func WithLogger(log *slog.Logger) Option {
+	return func(p *Pipeline) error {
+		p.log = log
+		return nil
+	}
+}
+
+// WithSink sends every Snapshot to s on a goroutine of its own. A slow or
+// failing sink loses snapshots, reported to WithErrorOutput, but never
+// delays aggregation or other sinks. s is closed when Run returns.
+func WithSink(name string, s Sink) Option {
+	return func(p *Pipeline) error {
+		if p.sinks == nil {
+			p.sinks = map[string]sink.Sink{}
+		}
+		if _, ok := p.sinks[name]; ok {
+			return fmt.Errorf("aggregator: duplicate sink %q", name)
+		}
+		p.sinks[name] = s
+		return nil
+	}
+}
+
+// OnTick registers fn to run on the aggregator goroutine after every
+// summary, callbacks run in registration order and should return quickly.
+func OnTick(fn func(Tick)) Option {
+	return func(p *Pipeline) error {
+		p.onTick = append(p.onTick, fn)
+		return nil
+	}
+}
@@ -0,0 +1,268 @@
+package aggregator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	src := ReaderSource(strings.NewReader(""))
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantError string
+	}{
+		{
+			name: "single source",
+			opts: []Option{WithSource("a", src)},
+		},
+		{
+			name:      "no sources",
+			opts:      []Option{WithInterval(time.Second)},
+			wantError: "no sources",
+		},
+		{
+			name:      "duplicate source",
+			opts:      []Option{WithFile("a.log"), WithFile("a.log")},
+			wantError: `duplicate source "a.log"`,
+		},
+		{
+			name:      "nil source",
+			opts:      []Option{WithSource("a", nil)},
+			wantError: `nil source "a"`,
+		},
+		{
+			name:      "invalid interval",
+			opts:      []Option{WithSource("a", src), WithInterval(0)},
+			wantError: "invalid interval",
+		},
+		{
+			name:      "invalid workers",
+			opts:      []Option{WithSource("a", src), WithWorkers(0)},
+			wantError: "invalid workers",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(tt.opts...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("New() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil || p == nil {
+				t.Fatalf("New() = %v, %v", p, err)
+			}
+		})
+	}
+}
+
+func TestPipeline_RunFileAndSource(t *testing.T) {
+	fpath := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(fpath, []byte(`{"time":"2025-08-14T02:07:12Z","host":"file.com","status_code":200,"duration":0.1}`+"\n"), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	var ticks []Tick
+	var out bytes.Buffer
+	p, err := New(
+		WithFile(fpath),
+		WithFromStart(true),
+		WithSource("inline", ReaderSource(strings.NewReader(`{"time":"2025-08-14T02:07:12Z","host":"inline.com","status_code":500,"duration":0.2}`))),
+		WithWorkers(2),
+		WithDistinctField("host"),
+		WithOutput(&out),
+		WithErrorOutput(io.Discard),
+		OnTick(func(tk Tick) { ticks = append(ticks, tk) }),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// the file source never ends, stop once both records are in
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := p.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(ticks) == 0 || !ticks[len(ticks)-1].Final {
+		t.Fatalf("expected a final tick, got %d ticks", len(ticks))
+	}
+	for _, host := range []string{"file.com", "inline.com", "uniq_host"} {
+		if !strings.Contains(out.String(), host) {
+			t.Errorf("output missing %q: %s", host, out.String())
+		}
+	}
+}
+
+func TestReaderSource(t *testing.T) {
+	src := ReaderSource(strings.NewReader("a\nb"))
+	for _, want := range []string{"a\n", "b"} {
+		got, err := src.GetRawRecord()
+		if err != nil || string(got) != want {
+			t.Fatalf("GetRawRecord() = %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := src.GetRawRecord(); err != ErrExhausted {
+		t.Errorf("GetRawRecord() at end error = %v, want ErrExhausted", err)
+	}
+	if err := src.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestPipeline_ReaderSourceMaxLineSize(t *testing.T) {
+	in := `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}
+` + strings.Repeat("x", 10000) + `
+{"time":"2025-08-14T02:07:13Z","host":"b.com","status_code":200,"duration":0.1}
+` + strings.Repeat("y", 200)
+	c := &collectSink{}
+	p, err := New(
+		WithSource("stdin", ReaderSource(strings.NewReader(in))),
+		WithMaxLineSize(100),
+		WithSink("collect", c),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	snap := c.snaps[len(c.snaps)-1]
+	if len(snap.Rows) != 2 || snap.Malformed != 0 || snap.Inputs[0].Oversize != 2 {
+		t.Errorf("got %d rows, %d malformed, %d oversize, want 2 rows and the 2 long lines skipped",
+			len(snap.Rows), snap.Malformed, snap.Inputs[0].Oversize)
+	}
+}
+
+type collectSink struct {
+	snaps  []Snapshot
+	closed bool
+}
+
+func (c *collectSink) Write(s Snapshot) error { c.snaps = append(c.snaps, s); return nil }
+func (c *collectSink) Close() error           { c.closed = true; return nil }
+
+func TestPipeline_WithSink(t *testing.T) {
+	c := &collectSink{}
+	p, err := New(
+		WithSource("inline", ReaderSource(strings.NewReader(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}`))),
+		WithSink("collect", c),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Run waits for sinks to close, so reading is safe here
+	if !c.closed {
+		t.Error("sink not closed after Run")
+	}
+	if len(c.snaps) != 1 || !c.snaps[0].Final || len(c.snaps[0].Rows) != 1 || c.snaps[0].Rows[0].Host != "a.com" {
+		t.Errorf("sink got %+v, want one final snapshot with a.com", c.snaps)
+	}
+
+	if _, err := New(WithSource("a", ReaderSource(strings.NewReader(""))), WithSink("x", c), WithSink("x", c)); err == nil {
+		t.Error("New() with duplicate sink names should fail")
+	}
+}
+
+func TestPipeline_WithFraming(t *testing.T) {
+	pretty := `{
+  "time": "2025-08-14T02:07:12Z",
+  "host": "a.com",
+  "status_code": 200,
+  "duration": 0.1
+}
+{
+  "time": "2025-08-14T02:07:13Z",
+  "host": "b.com",
+  "status_code": 500,
+  "duration": 0.2
+}
+`
+	c := &collectSink{}
+	p, err := New(
+		WithSource("stdin", ReaderSource(strings.NewReader(pretty))),
+		WithFraming("stdin", Framing{Framing: FrameJSON}),
+		WithSink("collect", c),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	snap := c.snaps[len(c.snaps)-1]
+	if snap.Malformed != 0 || len(snap.Rows) != 2 {
+		t.Errorf("got %d rows and %d malformed, want 2 rows and none malformed", len(snap.Rows), snap.Malformed)
+	}
+
+	if _, err := New(WithFraming("missing", Framing{Framing: FrameJSON})); err == nil {
+		t.Error("New() framing an unknown source should fail")
+	}
+}
+
+func TestPipeline_WithReplay(t *testing.T) {
+	old := `{"time":"2025-08-14T02:07:00Z","host":"a.com","status_code":200,"duration":0.1}
+{"time":"2025-08-14T02:07:01.5Z","host":"a.com","status_code":200,"duration":0.1}
+{"time":"2025-08-14T02:07:02.5Z","host":"a.com","status_code":200,"duration":0.1}
+`
+	c := &collectSink{}
+	p, err := New(
+		WithSource("old", ReaderSource(strings.NewReader(old))),
+		WithReplay(0),
+		WithInterval(time.Second),
+		WithSink("collect", c),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	var got []string
+	for _, snap := range c.snaps {
+		got = append(got, snap.Time.Format("15:04:05.0"))
+	}
+	want := []string{"02:07:01.0", "02:07:02.0", "02:07:02.5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("snapshots as of %v, want %v", got, want)
+	}
+
+	// a file replays from the beginning by default
+	path := filepath.Join(t.TempDir(), "old.log")
+	if err := os.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c = &collectSink{}
+	p, err = New(WithFile(path), WithReplay(0), WithInterval(time.Second), WithSink("collect", c), WithErrorOutput(io.Discard))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := p.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if n := len(c.snaps); n == 0 || len(c.snaps[n-1].Rows) != 1 || c.snaps[n-1].Rows[0].Requests != 3 {
+		t.Errorf("file replay snapshots = %+v, want every record of the file", c.snaps)
+	}
+
+	if _, err := New(WithReplay(-1)); err == nil {
+		t.Error("New() with a negative replay speed should fail")
+	}
+	if _, err := New(WithFile("a.log"), WithFile("b.log"), WithReplay(0)); err == nil {
+		t.Error("New() replaying several sources should fail")
+	}
+}
@@ -0,0 +1,47 @@
+package aggregator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCompatibility pins what the public aliases promise, see the package
+// documentation. Additions are fine, anything listed here must stay.
+func TestCompatibility(t *testing.T) {
+	fields := map[reflect.Type][]string{
+		reflect.TypeFor[Record]():        {"Time time.Time", "Host string", "StatusCode int", "Duration float64"},
+		reflect.TypeFor[Row]():           {"Host string", "Requests int", "Requests2xx int", "DurationTotal float64", "Distinct uint64", "ByClass [6]int"},
+		reflect.TypeFor[Snapshot]():      {"Time time.Time", "Final bool", "Rows []accesslog.Row", "Malformed int", "Overflow int", "Inputs []sink.InputStats", "SLOs []accesslog.SLOStatus", "Anomalies []anomaly.Event"},
+		reflect.TypeFor[StartPosition](): {"Kind tailer.StartKind", "Offset int64", "Lines int", "Time time.Time"},
+		reflect.TypeFor[Framing]():       {"Framing tailer.Framing", "Start *regexp.Regexp", "FlushTimeout time.Duration", "MaxSize int", "Clock clock.Clock"},
+	}
+	for typ, want := range fields {
+		for _, f := range want {
+			name, ftype, _ := strings.Cut(f, " ")
+			got, ok := typ.FieldByName(name)
+			if !ok || got.Type.String() != ftype {
+				t.Errorf("%v lost field %s", typ, f)
+			}
+		}
+	}
+
+	methods := map[reflect.Type][]string{
+		reflect.TypeFor[Summarizer](): {"Aggregate", "Format"},
+		reflect.TypeFor[Sink]():       {"Write", "Close"},
+		reflect.TypeFor[Clock]():      {"Now", "Since", "After", "NewTicker"},
+		reflect.TypeFor[*FakeClock](): {"Now", "Since", "After", "NewTicker", "Advance", "BlockUntil"},
+		reflect.TypeFor[Row]():        {"AvgDuration"},
+	}
+	for typ, want := range methods {
+		for _, m := range want {
+			if _, ok := typ.MethodByName(m); !ok {
+				t.Errorf("%v lost method %s", typ, m)
+			}
+		}
+		// an interface embedders implement must not grow
+		if typ.Kind() == reflect.Interface && typ.NumMethod() != len(want) {
+			t.Errorf("%v has %d methods, want %d", typ, typ.NumMethod(), len(want))
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package aggregator is the importable API of the access log aggregator. It
+// lets another service embed the file tailer and the per-host summarizer,
+// plug in its own record sources and receive every summary as a callback.
+//
+//	p, err := aggregator.New(
+//		aggregator.WithFile("/var/log/proxy/access.log"),
+//		aggregator.WithInterval(30*time.Second),
+//		aggregator.OnTick(func(t aggregator.Tick) { publish(t) }),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	return p.Run(ctx)
+//
+// # Compatibility
+//
+// Identifiers declared by this package follow semantic versioning: within a
+// major version Pipeline, Tick, Option and the With functions are not
+// removed or renamed, and their signatures do not change. New options and
+// Tick fields may be added in minor releases. The text layout written to
+// WithOutput is meant for humans and may change at any time, use OnTick for
+// anything machine read.
+//
+// Record, Summarizer, Clock, FakeClock, Snapshot, Row, Sink, Framing and
+// StartPosition are aliases of types under internal/ and are under the same
+// promise, as are the types reachable through their fields and methods,
+// such as the InputStats and SLOStatus of a Snapshot: exported fields and
+// methods are not removed, renamed or retyped within a major version, and
+// interfaces gain no methods. New fields may be added in minor releases.
+// The internal types behind them are frozen accordingly, everything else
+// under internal/ may change in any release.
+package aggregator
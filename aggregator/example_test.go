@@ -0,0 +1,53 @@
+package aggregator_test
+
+import (
+	"accessAggregator/aggregator"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const logLines = `{"time":"2025-08-14T02:07:12Z","host":"api.example.com","status_code":200,"duration":0.120}
+{"time":"2025-08-14T02:07:13Z","host":"api.example.com","status_code":502,"duration":0.480}
+{"time":"2025-08-14T02:07:14Z","host":"www.example.com","status_code":200,"duration":0.050}
+`
+
+func Example() {
+	p, err := aggregator.New(
+		aggregator.WithSource("inline", aggregator.ReaderSource(strings.NewReader(logLines))),
+		aggregator.WithClock(aggregator.NewFakeClock(time.Date(2025, 8, 14, 2, 8, 0, 0, time.UTC))),
+		aggregator.OnTick(func(t aggregator.Tick) {
+			if t.Final {
+				fmt.Print(t.Summary.Format(t.Time))
+			}
+		}),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// the only source is finite, so Run returns once it is drained
+	if err := p.Run(context.Background()); err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// *** Access Log Summary as of 2025-08-14 02:08:00 ***
+	// =========================================================================================
+	// Host               total_requests    2xx_requests   non_2xx_requests     avg_duration_s
+	// -----------------------------------------------------------------------------------------
+	// api.example.com                 2               1                  1              0.300
+	// www.example.com                 1               1                  0              0.050
+	// =========================================================================================
+}
+
+func ExampleNewRecord() {
+	r, err := aggregator.NewRecord([]byte(`{"time":"2025-08-14T02:07:12Z","host":"api.example.com","status_code":404,"duration":0.25}`))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(r.Host, r.StatusCode, r.Duration)
+	// Output: api.example.com 404 0.25
+}
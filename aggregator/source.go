@@ -0,0 +1,89 @@
+package aggregator
+
+import (
+	"accessAggregator/internal/tailer"
+	"bufio"
+	"io"
+)
+
+// Source is a stream of raw JSON records, one per GetRawRecord call. It
+// generalises the file tailer: return io.EOF when nothing new is available
+// yet and the pipeline polls again later, return ErrExhausted when the
+// source is finished for good.
+type Source interface {
+	GetRawRecord() ([]byte, error)
+	Close() error
+}
+
+// ErrExhausted ends a Source without reporting an error.
+var ErrExhausted = tailer.ErrExhausted
+
+// ReaderSource reads newline separated records from r until it hits EOF,
+// then reports ErrExhausted. Close closes r if it is an io.Closer. Lines
+// longer than WithMaxLineSize are skipped and counted like in files.
+func ReaderSource(r io.Reader) Source {
+	return &readerSource{r: r, reader: bufio.NewReader(r)}
+}
+
+type readerSource struct {
+	r        io.Reader
+	reader   *bufio.Reader
+	maxLine  int // 0 for no limit
+	oversize int64
+}
+
+// lineLimiter is a Source the pipeline hands WithMaxLineSize to
+type lineLimiter interface {
+	setMaxLineSize(n int)
+}
+
+func (s *readerSource) setMaxLineSize(n int) { s.maxLine = n }
+
+// GetRawRecord holds at most maxLine bytes of a line, longer ones are
+// discarded up to their newline.
+func (s *readerSource) GetRawRecord() ([]byte, error) {
+	var line []byte
+	skipping := false
+	for {
+		chunk, err := s.reader.ReadSlice('\n')
+		n := len(line) + len(chunk)
+		if err == nil {
+			n-- // the newline
+		}
+		switch {
+		case skipping:
+		case s.maxLine > 0 && n > s.maxLine:
+			skipping = true
+			s.oversize++
+			line = nil
+		default:
+			line = append(line, chunk...)
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+		case err == nil && skipping:
+			skipping = false
+		case err == io.EOF:
+			// last line without a trailing newline
+			if len(line) > 0 {
+				return line, nil
+			}
+			return nil, ErrExhausted
+		default:
+			return line, err
+		}
+	}
+}
+
+// Oversize is how many lines longer than WithMaxLineSize were skipped.
+func (s *readerSource) Oversize() int64 {
+	return s.oversize
+}
+
+func (s *readerSource) Close() error {
+	if c, ok := s.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
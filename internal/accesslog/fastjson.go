@@ -0,0 +1,440 @@
+package accesslog
+
+import (
+	"bytes"
+	"strconv"
+	"unicode/utf8"
+)
+
+// interned hosts kept per parser before the table is reset, bounds memory
+// when hosts are random
+const maxInterned = 1 << 14
+
+// parser decodes records with a hand written scanner for the fixed Record
+// schema, and falls back to encoding/json (decodeRecord) whenever the input
+// is anything but plain: escaped or case folded keys, nested values in a
+// field we read, numbers that need full float parsing, invalid JSON...
+//
+// A parser is not safe for concurrent use.
+type parser struct {
+	field string
+	hosts map[string]string // nil disables interning
+}
+
+func newParser(field string) *parser {
+	return &parser{field: field, hosts: make(map[string]string)}
+}
+
+func (p *parser) parse(rawRecord []byte, r *Record) error {
+	if !p.scan(rawRecord, r) {
+		*r = Record{}
+		if err := decodeRecord(rawRecord, p.field, r); err != nil {
+			return err
+		}
+	}
+	return r.validate()
+}
+
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindNumber
+	kindLiteral // true, false, null
+	kindNested  // object or array
+)
+
+// scan fills r from b and reports whether it could. On false r is in an
+// unspecified state and the caller must decode b again the slow way.
+func (p *parser) scan(b []byte, r *Record) bool {
+	i := skipSpace(b, 0)
+	if i >= len(b) || b[i] != '{' {
+		return false
+	}
+	i = skipSpace(b, i+1)
+
+	if i < len(b) && b[i] == '}' {
+		return skipSpace(b, i+1) == len(b)
+	}
+
+	for {
+		key, next, ok := scanKey(b, i)
+		if !ok {
+			return false
+		}
+		i = skipSpace(b, next)
+		if i >= len(b) || b[i] != ':' {
+			return false
+		}
+		i = skipSpace(b, i+1)
+
+		end, kind, escaped, ok := scanValue(b, i, 0)
+		if !ok {
+			return false
+		}
+		val := b[i:end]
+
+		if p.field != "" && string(key) == p.field {
+			if !p.setDistinct(r, val, kind, escaped) {
+				return false
+			}
+		}
+		if !p.setField(r, key, val, kind, escaped) {
+			return false
+		}
+
+		i = skipSpace(b, end)
+		if i >= len(b) {
+			return false
+		}
+		if b[i] == '}' {
+			return skipSpace(b, i+1) == len(b)
+		}
+		if b[i] != ',' {
+			return false
+		}
+		i = skipSpace(b, i+1)
+	}
+}
+
+func (p *parser) setField(r *Record, key, val []byte, kind valueKind, escaped bool) bool {
+	switch string(key) {
+	case "time":
+		// encoding/json hands the raw literal to Time.UnmarshalJSON as well
+		if kind != kindString && string(val) != "null" {
+			return false
+		}
+		return r.Time.UnmarshalJSON(val) == nil
+	case "host":
+		if string(val) == "null" {
+			return true
+		}
+		if kind != kindString || escaped {
+			return false
+		}
+		host := val[1 : len(val)-1]
+		if !utf8.Valid(host) {
+			return false
+		}
+		r.Host = p.intern(host)
+	case "status_code":
+		if string(val) == "null" {
+			return true
+		}
+		if kind != kindNumber {
+			return false
+		}
+		n, ok := parseInt(val)
+		if !ok {
+			return false
+		}
+		r.StatusCode = n
+	case "duration":
+		if string(val) == "null" {
+			return true
+		}
+		if kind != kindNumber {
+			return false
+		}
+		f, ok := parseFloat(val)
+		if !ok {
+			return false
+		}
+		r.Duration = f
+	default:
+		// encoding/json matches struct fields case insensitively
+		for _, known := range [...]string{"time", "host", "status_code", "duration"} {
+			if bytes.EqualFold(key, []byte(known)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *parser) setDistinct(r *Record, val []byte, kind valueKind, escaped bool) bool {
+	switch kind {
+	case kindString:
+		v := val[1 : len(val)-1]
+		if escaped || !utf8.Valid(v) {
+			return false
+		}
+		r.Distinct = string(v)
+	case kindNumber, kindLiteral:
+		if string(val) == "null" {
+			r.Distinct = ""
+		} else {
+			r.Distinct = string(val)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (p *parser) intern(b []byte) string {
+	if p.hosts == nil {
+		return string(b)
+	}
+	if s, ok := p.hosts[string(b)]; ok {
+		return s
+	}
+	if len(p.hosts) >= maxInterned {
+		clear(p.hosts)
+	}
+	s := string(b)
+	p.hosts[s] = s
+	return s
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) {
+		switch b[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// scanKey accepts only printable ASCII keys without escapes, so a key
+// compares equal here exactly when it does for encoding/json
+func scanKey(b []byte, i int) ([]byte, int, bool) {
+	if i >= len(b) || b[i] != '"' {
+		return nil, 0, false
+	}
+	for j := i + 1; j < len(b); j++ {
+		c := b[j]
+		if c == '"' {
+			return b[i+1 : j], j + 1, true
+		}
+		if c < 0x20 || c >= utf8.RuneSelf || c == '\\' {
+			return nil, 0, false
+		}
+	}
+	return nil, 0, false
+}
+
+const maxDepth = 32
+
+// scanValue validates the JSON value starting at b[i] and returns the index
+// just past it
+func scanValue(b []byte, i, depth int) (end int, kind valueKind, escaped, ok bool) {
+	if i >= len(b) || depth > maxDepth {
+		return 0, 0, false, false
+	}
+	switch c := b[i]; {
+	case c == '"':
+		end, escaped, ok = scanString(b, i)
+		return end, kindString, escaped, ok
+	case c == '-' || (c >= '0' && c <= '9'):
+		end, ok = scanNumber(b, i)
+		return end, kindNumber, false, ok
+	case c == 't':
+		return scanLiteral(b, i, "true")
+	case c == 'f':
+		return scanLiteral(b, i, "false")
+	case c == 'n':
+		return scanLiteral(b, i, "null")
+	case c == '{' || c == '[':
+		end, ok = scanNested(b, i, depth)
+		return end, kindNested, false, ok
+	}
+	return 0, 0, false, false
+}
+
+func scanLiteral(b []byte, i int, lit string) (int, valueKind, bool, bool) {
+	if !bytes.HasPrefix(b[i:], []byte(lit)) {
+		return 0, 0, false, false
+	}
+	return i + len(lit), kindLiteral, false, true
+}
+
+func scanString(b []byte, i int) (end int, escaped, ok bool) {
+	for j := i + 1; j < len(b); j++ {
+		switch c := b[j]; {
+		case c == '"':
+			return j + 1, escaped, true
+		case c < 0x20:
+			return 0, false, false
+		case c == '\\':
+			escaped = true
+			j++
+			if j >= len(b) {
+				return 0, false, false
+			}
+			switch b[j] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if j+4 >= len(b) {
+					return 0, false, false
+				}
+				for _, h := range b[j+1 : j+5] {
+					if !isHex(h) {
+						return 0, false, false
+					}
+				}
+				j += 4
+			default:
+				return 0, false, false
+			}
+		}
+	}
+	return 0, false, false
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// scanNumber follows the JSON number grammar
+// -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?
+func scanNumber(b []byte, i int) (int, bool) {
+	if i < len(b) && b[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(b) && b[i] == '0':
+		i++
+	case i < len(b) && b[i] >= '1' && b[i] <= '9':
+		i = skipDigits(b, i)
+	default:
+		return 0, false
+	}
+	if i < len(b) && b[i] == '.' {
+		j := skipDigits(b, i+1)
+		if j == i+1 {
+			return 0, false
+		}
+		i = j
+	}
+	if i < len(b) && (b[i] == 'e' || b[i] == 'E') {
+		i++
+		if i < len(b) && (b[i] == '+' || b[i] == '-') {
+			i++
+		}
+		j := skipDigits(b, i)
+		if j == i {
+			return 0, false
+		}
+		i = j
+	}
+	return i, true
+}
+
+func skipDigits(b []byte, i int) int {
+	for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+func scanNested(b []byte, i, depth int) (int, bool) {
+	closer := byte(']')
+	isObject := b[i] == '{'
+	if isObject {
+		closer = '}'
+	}
+	i = skipSpace(b, i+1)
+	if i < len(b) && b[i] == closer {
+		return i + 1, true
+	}
+	for {
+		if isObject {
+			if i >= len(b) || b[i] != '"' {
+				return 0, false
+			}
+			end, _, ok := scanString(b, i)
+			if !ok {
+				return 0, false
+			}
+			i = skipSpace(b, end)
+			if i >= len(b) || b[i] != ':' {
+				return 0, false
+			}
+			i = skipSpace(b, i+1)
+		}
+		end, _, _, ok := scanValue(b, i, depth+1)
+		if !ok {
+			return 0, false
+		}
+		i = skipSpace(b, end)
+		if i >= len(b) {
+			return 0, false
+		}
+		if b[i] == closer {
+			return i + 1, true
+		}
+		if b[i] != ',' {
+			return 0, false
+		}
+		i = skipSpace(b, i+1)
+	}
+}
+
+// parseInt handles what fits in an int without overflow checks, longer
+// literals and fractions or exponents (an error for encoding/json) fall back
+func parseInt(b []byte) (int, bool) {
+	neg := b[0] == '-'
+	if neg {
+		b = b[1:]
+	}
+	if len(b) > 18 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	if neg {
+		n = -n
+	}
+	return n, true
+}
+
+var pow10 = [...]float64{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10,
+	1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20, 1e21, 1e22}
+
+// parseFloat takes the exact fast path when the digits fit in 15 decimal
+// places and there is no exponent: mantissa and power of ten are both exact
+// float64 values, so one correctly rounded division gives the same result
+// as strconv.ParseFloat. Everything else goes through strconv.
+func parseFloat(b []byte) (float64, bool) {
+	neg := b[0] == '-'
+	digits := b
+	if neg {
+		digits = b[1:]
+	}
+
+	var mant uint64
+	n, frac := 0, -1
+	for i, c := range digits {
+		switch {
+		case c >= '0' && c <= '9':
+			mant = mant*10 + uint64(c-'0')
+			n++
+		case c == '.':
+			frac = i
+		default:
+			n = 16 // exponent, take the slow path
+		}
+		if n > 15 {
+			f, err := strconv.ParseFloat(string(b), 64)
+			return f, err == nil
+		}
+	}
+
+	f := float64(mant)
+	if frac >= 0 {
+		f /= pow10[len(digits)-frac-1]
+	}
+	if neg {
+		f = -f
+	}
+	return f, true
+}
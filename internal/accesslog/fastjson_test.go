@@ -0,0 +1,204 @@
+package accesslog
+
+import (
+	"reflect"
+	"testing"
+)
+
+// reference is the encoding/json only path the scanner must agree with
+func reference(rawRecord []byte, field string) (Record, error) {
+	var r Record
+	if err := decodeRecord(rawRecord, field, &r); err != nil {
+		return Record{}, err
+	}
+	return r, r.validate()
+}
+
+func checkEquivalent(t *testing.T, rawRecord []byte, field string) {
+	t.Helper()
+	want, wantErr := reference(rawRecord, field)
+
+	var got Record
+	gotErr := newParser(field).parse(rawRecord, &got)
+
+	if (gotErr != nil) != (wantErr != nil) {
+		t.Fatalf("parse(%q) error = %v, reference error = %v", rawRecord, gotErr, wantErr)
+	}
+	if gotErr == nil && !reflect.DeepEqual(got, want) {
+		t.Fatalf("parse(%q) = %+v, reference = %+v", rawRecord, got, want)
+	}
+}
+
+func TestParser_MatchesReferenceOnCorpus(t *testing.T) {
+	lines := readTestLog(t)
+	scanned := 0
+	for _, l := range lines {
+		checkEquivalent(t, l, "")
+		checkEquivalent(t, l, "host")
+
+		var r Record
+		if newParser("").scan(l, &r) {
+			scanned++
+		}
+	}
+	// the corpus is plain, it should never need the fallback
+	if scanned != len(lines) {
+		t.Errorf("fast path handled %d of %d corpus lines", scanned, len(lines))
+	}
+}
+
+func TestParser_MatchesReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawRecord string
+		field     string
+		wantFast  bool // scanner handles it without falling back
+	}{
+		{
+			name:      "plain record",
+			rawRecord: `{"time":"2025-08-14T02:07:12.680651416Z","host":"chatgpt.com","status_code":200,"duration":0.224254673}`,
+			wantFast:  true,
+		},
+		{
+			name:      "arbitrary key order, whitespace and unknown keys",
+			rawRecord: " { \"level\" : \"INFO\", \"duration\":0.5 ,\"size\":16,\"ok\":true,\"x\":null,\"status_code\":404,\"host\":\"a.com\",\"time\":\"2025-08-14T02:07:12Z\"}\n",
+			wantFast:  true,
+		},
+		{
+			name:      "nested unknown values",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"tags":{"a":[1,2,{"b":"c\"d"}]},"list":[]}`,
+			wantFast:  true,
+		},
+		{
+			name:      "distinct field string",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`,
+			field:     "client_ip",
+			wantFast:  true,
+		},
+		{
+			name:      "distinct field number",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"user":1e3}`,
+			field:     "user",
+			wantFast:  true,
+		},
+		{
+			name:      "distinct field object falls back",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"user":{ "id" : 1 }}`,
+			field:     "user",
+		},
+		{
+			name:      "distinct field is a known field",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}`,
+			field:     "status_code",
+			wantFast:  true,
+		},
+		{
+			name:      "duplicate keys last wins",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","host":"b.com","status_code":200,"duration":0.1,"duration":null}`,
+			wantFast:  true,
+		},
+		{
+			name:      "case folded key falls back",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","HOST":"a.com","status_code":200,"duration":0.1}`,
+		},
+		{
+			name:      "escaped host falls back",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a\u002ecom","status_code":200,"duration":0.1}`,
+		},
+		{
+			name:      "invalid utf8 host falls back",
+			rawRecord: "{\"time\":\"2025-08-14T02:07:12Z\",\"host\":\"a\xffcom\",\"status_code\":200,\"duration\":0.1}",
+		},
+		{
+			name:      "time with offset",
+			rawRecord: `{"time":"2025-08-14T02:07:12+07:00","host":"a.com","status_code":200,"duration":0.1}`,
+			wantFast:  true,
+		},
+		{
+			name:      "long duration uses strconv",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.12345678901234567891}`,
+			wantFast:  true,
+		},
+		{
+			name:      "duration with exponent",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":2.5e-3}`,
+			wantFast:  true,
+		},
+		{
+			name:      "fractional status code",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200.0,"duration":0.1}`,
+		},
+		{
+			name:      "status code as string",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":"200","duration":0.1}`,
+		},
+		{
+			name:      "missing field",
+			rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","duration":0.1}`,
+			wantFast:  true,
+		},
+		{name: "trailing garbage", rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}x`},
+		{name: "trailing comma", rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,}`},
+		{name: "leading zero", rawRecord: `{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":0200,"duration":0.1}`},
+		{name: "not an object", rawRecord: `[1,2,3]`},
+		{name: "empty object", rawRecord: `{}`, wantFast: true},
+		{name: "empty line", rawRecord: ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkEquivalent(t, []byte(tt.rawRecord), tt.field)
+
+			var r Record
+			if fast := newParser(tt.field).scan([]byte(tt.rawRecord), &r); fast != tt.wantFast {
+				t.Errorf("scan() handled = %v, want %v", fast, tt.wantFast)
+			}
+		})
+	}
+}
+
+func TestParser_NoAllocs(t *testing.T) {
+	raw := []byte(`{"time":"2025-08-14T02:07:12.680651416Z","host":"chatgpt.com","status_code":200,"duration":0.224254673}`)
+	p := newParser("")
+	var r Record
+	p.parse(raw, &r) // intern the host
+
+	allocs := testing.AllocsPerRun(100, func() {
+		p.parse(raw, &r)
+	})
+	if allocs != 0 {
+		t.Errorf("parse() allocates %v times per record, want 0", allocs)
+	}
+}
+
+func FuzzParser(f *testing.F) {
+	for _, l := range readTestLog(f)[:20] {
+		f.Add(l, "")
+	}
+	f.Add([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`), "client_ip")
+	f.Add([]byte(`{"Host":"a\u0000","time":null,"duration":-0.0,"x":[{"y":"\ud800"}]}`), "x")
+	f.Add([]byte(`{"status_code":-0,"duration":1E400}`), "")
+
+	f.Fuzz(func(t *testing.T, rawRecord []byte, field string) {
+		checkEquivalent(t, rawRecord, field)
+	})
+}
+
+func BenchmarkParse(b *testing.B) {
+	lines := readTestLog(b)
+
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			reference(lines[i%len(lines)], "")
+		}
+	})
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		p := newParser("")
+		var r Record
+		for i := range b.N {
+			p.parse(lines[i%len(lines)], &r)
+		}
+	})
+}
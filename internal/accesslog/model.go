@@ -1,46 +1,231 @@
 package accesslog
 
 import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/hll"
+	"container/list"
 	"encoding/json"
 	"fmt"
 	"time"
 )
 
+// Record is public as aggregator.Record, changes must keep its
+// compatibility promise.
 type Record struct {
 	Time       time.Time `json:"time"`
 	Host       string    `json:"host"`
 	StatusCode int       `json:"status_code"`
 	Duration   float64   `json:"duration"`
+
+	// value of Options.DistinctField, empty when not configured or absent
+	Distinct string `json:"-"`
 }
 
 func NewRecord(rawRecord []byte) (*Record, error) {
+	return newRecordWithField(rawRecord, "")
+}
+
+// newRecordWithField is NewRecord plus extraction of an arbitrary top level
+// field into Record.Distinct
+func newRecordWithField(rawRecord []byte, field string) (*Record, error) {
 	var r Record
-	err := json.Unmarshal(rawRecord, &r)
+	p := parser{field: field}
+	if err := p.parse(rawRecord, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
 
+// decodeRecord is the reference encoding/json decoder, the fast scanner must
+// agree with it on every input it accepts. String values of field are
+// unquoted and anything else is kept as raw JSON.
+func decodeRecord(rawRecord []byte, field string, r *Record) error {
 	// NOTE: ignore line should handled on caller
-	if err != nil {
-		return nil, fmt.Errorf("invalid JSON: %w", err)
+	if err := json.Unmarshal(rawRecord, r); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
 	}
-	if r.Time.IsZero() || r.Host == "" || r.StatusCode == 0 || r.Duration == 0 {
-		return nil, fmt.Errorf("missing or invalid required field")
+	if field == "" {
+		return nil
 	}
 
-	return &r, nil
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(rawRecord, &fields); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	v, ok := fields[field]
+	if !ok || string(v) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(v, &r.Distinct); err != nil {
+		r.Distinct = string(v)
+	}
+	return nil
+}
+
+func (r *Record) validate() error {
+	if r.Time.IsZero() || r.Host == "" || r.StatusCode == 0 || r.Duration == 0 {
+		return fmt.Errorf("missing or invalid required field")
+	}
+	return nil
 }
 
 type summary struct {
 	requestTotal  int
 	request2xx    int
-	durationTotal float64 // in seconds
+	durationTotal float64     // in seconds
+	distinct      *hll.Sketch // nil unless distinct counting is enabled
+	byClass       [6]int      // requests per StatusClass
+}
+
+// StatusClass maps a status code to its class, 1 for 1xx up to 5xx, and 0
+// for codes outside 100-599.
+func StatusClass(code int) int {
+	if code < 100 || code >= 600 {
+		return 0
+	}
+	return code / 100
 }
 
+// Summarizer is public as aggregator.Summarizer, changes must keep its
+// compatibility promise.
 type Summarizer interface {
 	Aggregate(rawRecord []byte) error
-	Format() string
+	Format(asOf time.Time) string
 }
 
 type Summaries map[string]summary
 
+// Row is one host of a summary as plain values, for consumers other than
+// the text table. Public as aggregator.Row, changes must keep its
+// compatibility promise.
+type Row struct {
+	Host          string  `json:"host"`
+	Requests      int     `json:"requests"`
+	Requests2xx   int     `json:"requests_2xx"`
+	DurationTotal float64 `json:"duration_total_s"`
+	// estimated unique values of Options.DistinctField, 0 when disabled
+	Distinct uint64 `json:"distinct,omitempty"`
+	// requests per StatusClass, index 0 counts codes outside 100-599
+	ByClass [6]int `json:"by_class"`
+}
+
+func (r Row) AvgDuration() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return r.DurationTotal / float64(r.Requests)
+}
+
+// Sub returns what r gained since prev, an earlier row of the same host.
+// Distinct is an estimate and not additive, it is kept as is.
+func (r Row) Sub(prev Row) Row {
+	r.Requests -= prev.Requests
+	r.Requests2xx -= prev.Requests2xx
+	r.DurationTotal -= prev.DurationTotal
+	for c := range r.ByClass {
+		r.ByClass[c] -= prev.ByClass[c]
+	}
+	return r
+}
+
+// Snapshotter is implemented by summarizers that can hand out their rows,
+// sorted by host.
+type Snapshotter interface {
+	Rows() []Row
+}
+
+// Marker is implemented by summarizers that can flag hosts in the table,
+// marks maps a host to a note printed in an extra column.
+type Marker interface {
+	FormatMarked(asOf time.Time, marks map[string]string) string
+}
+
 func NewSummaries() Summaries {
 	return make(Summaries)
 }
+
+// OverflowPolicy decides what happens to a new host once MaxGroups is reached.
+type OverflowPolicy int
+
+const (
+	// fold records of new hosts into the OtherGroup row
+	OverflowOther OverflowPolicy = iota
+	// drop the least recently seen host to make room
+	OverflowEvict
+)
+
+const OtherGroup = "__other__"
+
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch s {
+	case "other":
+		return OverflowOther, nil
+	case "evict":
+		return OverflowEvict, nil
+	}
+	return 0, fmt.Errorf("unknown overflow policy %q: want other or evict", s)
+}
+
+type Options struct {
+	// record field fed into a per-host HyperLogLog sketch, e.g. "client_ip"
+	DistinctField     string
+	DistinctPrecision uint8
+
+	// MaxGroups caps the number of hosts kept, 0 means unlimited
+	MaxGroups int
+	Overflow  OverflowPolicy
+
+	// objectives tracked alongside the per host summary
+	SLOs []SLO
+
+	// order, limit and columns of the table
+	View View
+
+	// the wall clock SLOs skip records too far ahead of, defaults to
+	// clock.Real
+	Clock clock.Clock
+}
+
+// Aggregator is a Summarizer that applies Options on top of Summaries.
+type Aggregator struct {
+	opts   Options
+	groups Summaries
+	parser *parser
+
+	// recency order of hosts, front is most recent, only kept for OverflowEvict
+	lru     *list.List
+	lruElem map[string]*list.Element
+
+	// records folded into OtherGroup, or hosts evicted
+	overflow int
+
+	slos []*sloTracker // one per Options.SLOs
+}
+
+func NewAggregator(opts Options) (*Aggregator, error) {
+	if opts.DistinctField != "" {
+		if opts.DistinctPrecision == 0 {
+			opts.DistinctPrecision = hll.DefaultPrecision
+		}
+		// validate precision once, instead of on every new host
+		if _, err := hll.New(opts.DistinctPrecision); err != nil {
+			return nil, err
+		}
+	}
+	if opts.MaxGroups < 0 {
+		return nil, fmt.Errorf("invalid max groups %d", opts.MaxGroups)
+	}
+
+	if opts.Clock == nil {
+		opts.Clock = clock.Real{}
+	}
+	a := &Aggregator{opts: opts, groups: NewSummaries(), parser: newParser(opts.DistinctField)}
+	if opts.MaxGroups > 0 && opts.Overflow == OverflowEvict {
+		a.lru = list.New()
+		a.lruElem = make(map[string]*list.Element)
+	}
+	for _, slo := range opts.SLOs {
+		a.slos = append(a.slos, newSLOTracker(slo, opts.Clock))
+	}
+	return a, nil
+}
@@ -7,43 +7,60 @@ import (
 	"time"
 )
 
-func (ss Summaries) sort() ([]string, int) {
+func (ss Summaries) sort() []string {
 	hosts := make([]string, 0, len(ss))
-	maxHostLen := 0
 	for h := range ss {
 		hosts = append(hosts, h)
-		l := len(h)
-		if l > maxHostLen {
-			maxHostLen = l
-		}
 	}
 	sort.Strings(hosts)
-	maxHostLen += 2
+	return hosts
+}
 
-	return hosts, maxHostLen
+// Format renders the table with asOf in the header, usually the tick time.
+func (ss Summaries) Format(asOf time.Time) string {
+	return formatRows(asOf, ss.Rows(), View{}.columns(""), nil)
 }
 
-func (ss Summaries) Format() string {
-	hosts, maxHostLen := ss.sort()
+// formatRows renders the table of rows in the given order, with a note
+// column when marks is not nil
+func formatRows(asOf time.Time, rows []Row, cols []Column, marks map[string]string) string {
+	maxHostLen := 0
+	for _, r := range rows {
+		maxHostLen = max(maxHostLen, len(r.Host))
+	}
+	maxHostLen += 2
+
+	width := maxHostLen + 2
+	for _, c := range cols {
+		width += c.width + 1
+	}
 
 	var b strings.Builder
 
 	fmt.Fprintln(&b)
-	fmt.Fprintln(&b, "*** Access Log Summary as of", time.Now().Format("2006-01-02 15:04:05"), "***")
-	fmt.Fprintln(&b, strings.Repeat("=", maxHostLen+72))
-	fmt.Fprintf(&b, "%-*s %15s %15s %18s %18s\n",
-		maxHostLen, "Host", "total_requests", "2xx_requests", "non_2xx_requests", "avg_duration_s")
-	fmt.Fprintln(&b, strings.Repeat("-", maxHostLen+72))
-
-	for _, h := range hosts {
-		fmt.Fprintf(&b, "%-*s %15d %15d %18d %18.3f\n",
-			maxHostLen, h,
-			ss[h].requestTotal,
-			ss[h].request2xx,
-			ss[h].requestTotal-ss[h].request2xx,
-			ss[h].durationTotal/float64(ss[h].requestTotal))
+	fmt.Fprintln(&b, "*** Access Log Summary as of", asOf.Format("2006-01-02 15:04:05"), "***")
+	fmt.Fprintln(&b, strings.Repeat("=", width))
+	fmt.Fprintf(&b, "%-*s", maxHostLen, "Host")
+	for _, c := range cols {
+		fmt.Fprintf(&b, " %*s", c.width, c.header)
+	}
+	if marks != nil {
+		fmt.Fprint(&b, "  anomaly")
+	}
+	fmt.Fprintln(&b)
+	fmt.Fprintln(&b, strings.Repeat("-", width))
+
+	for _, r := range rows {
+		fmt.Fprintf(&b, "%-*s", maxHostLen, r.Host)
+		for _, c := range cols {
+			fmt.Fprintf(&b, " %*s", c.width, c.format(r))
+		}
+		if m := marks[r.Host]; m != "" {
+			fmt.Fprint(&b, "  "+m)
+		}
+		fmt.Fprintln(&b)
 	}
-	fmt.Fprintln(&b, strings.Repeat("=", maxHostLen+72))
+	fmt.Fprintln(&b, strings.Repeat("=", width))
 
 	return b.String()
 }
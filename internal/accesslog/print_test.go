@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestSummaries_format(t *testing.T) {
@@ -35,7 +36,7 @@ func TestSummaries_format(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := tt.ss.Format()
+			got := tt.ss.Format(time.Now())
 
 			// Check header
 			if !strings.Contains(got, "Access Log Summary") {
@@ -64,25 +65,21 @@ func TestSummaries_format(t *testing.T) {
 
 func TestSummaries_sort(t *testing.T) {
 	tests := []struct {
-		name    string
-		ss      Summaries
-		want    []string
-		wantMax int
+		name string
+		ss   Summaries
+		want []string
 	}{
 		{
-			name: "empty summaries returns empty slice and base len 2",
+			name: "empty summaries returns empty slice",
 			ss:   Summaries{},
 			want: []string{},
-			// maxHostLen starts 0 + 2 padding
-			wantMax: 2,
 		},
 		{
 			name: "single host",
 			ss: Summaries{
 				"example.com": {},
 			},
-			want:    []string{"example.com"},
-			wantMax: len("example.com") + 2,
+			want: []string{"example.com"},
 		},
 		{
 			name: "multiple hosts sorted alphabetically",
@@ -91,8 +88,7 @@ func TestSummaries_sort(t *testing.T) {
 				"alpha.com":  {},
 				"middle.org": {},
 			},
-			want:    []string{"alpha.com", "middle.org", "zulu.com"},
-			wantMax: len("middle.org") + 2, // longest key + 2
+			want: []string{"alpha.com", "middle.org", "zulu.com"},
 		},
 		{
 			name: "hosts with equal length",
@@ -101,21 +97,45 @@ func TestSummaries_sort(t *testing.T) {
 				"ccc": {},
 				"bbb": {},
 			},
-			want:    []string{"aaa", "bbb", "ccc"},
-			wantMax: len("aaa") + 2,
+			want: []string{"aaa", "bbb", "ccc"},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, gotMax := tt.ss.sort()
+			got := tt.ss.sort()
 
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("sort() got hosts = %v, want %v", got, tt.want)
 			}
-			if gotMax != tt.wantMax {
-				t.Errorf("sort() got maxHostLen = %v, want %v", gotMax, tt.wantMax)
-			}
 		})
 	}
 }
+
+func TestAggregator_FormatDistinctColumn(t *testing.T) {
+	a, err := NewAggregator(Options{DistinctField: "client_ip"})
+	if err != nil {
+		t.Fatalf("NewAggregator() error = %v", err)
+	}
+	a.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`))
+	a.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.2"}`))
+
+	got := a.Format(time.Now())
+	if !strings.Contains(got, "uniq_client_ip") {
+		t.Errorf("Format() missing distinct column header: %v", got)
+	}
+	lines := strings.Split(got, "\n")
+	var row string
+	for _, l := range lines {
+		if strings.HasPrefix(l, "a.com") {
+			row = l
+		}
+	}
+	if fields := strings.Fields(row); len(fields) != 6 || fields[5] != "2" {
+		t.Errorf("Format() row = %q, want unique count 2 in last column", row)
+	}
+
+	if strings.Contains(NewSummaries().Format(time.Now()), "uniq_") {
+		t.Error("plain Summaries should not print a distinct column")
+	}
+}
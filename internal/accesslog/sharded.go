@@ -0,0 +1,172 @@
+package accesslog
+
+import (
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sharded is a Summarizer that parses records on a worker pool and
+// aggregates them into per-shard Aggregators chosen by host hash, so a host
+// always lands in the same shard. Shards are merged when formatting.
+//
+// Aggregate and Format must be called from a single goroutine, like any
+// other Summarizer. MaxGroups is split across shards, so the limit is
+// approximate: a shard whose hosts hash unevenly folds or evicts before the
+// others are full.
+type Sharded struct {
+	opts Options
+	seed maphash.Seed
+
+	work    chan []byte
+	shardIn []chan *Record
+	shards  []*Aggregator
+
+	// records handed to Aggregate but not yet counted by a shard
+	pending   sync.WaitGroup
+	malformed atomic.Int64
+
+	// the shards merged, until the next Aggregate
+	merged *Aggregator
+
+	workersDone sync.WaitGroup
+	shardsDone  sync.WaitGroup
+}
+
+func NewSharded(opts Options, workers, shards int) (*Sharded, error) {
+	if workers < 1 || shards < 1 {
+		return nil, fmt.Errorf("invalid sharded config: %d workers, %d shards", workers, shards)
+	}
+
+	if opts.MaxGroups > 0 && opts.MaxGroups < shards {
+		return nil, fmt.Errorf("invalid sharded config: max groups %d below %d shards", opts.MaxGroups, shards)
+	}
+
+	s := &Sharded{
+		opts:    opts,
+		seed:    maphash.MakeSeed(),
+		work:    make(chan []byte, workers*64),
+		shardIn: make([]chan *Record, shards),
+		shards:  make([]*Aggregator, shards),
+	}
+	for i := range shards {
+		shardOpts := opts
+		if opts.MaxGroups > 0 {
+			// the remainder goes to the first shards, the limits sum to MaxGroups
+			shardOpts.MaxGroups = opts.MaxGroups / shards
+			if i < opts.MaxGroups%shards {
+				shardOpts.MaxGroups++
+			}
+		}
+		a, err := NewAggregator(shardOpts)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = a
+		s.shardIn[i] = make(chan *Record, 256)
+	}
+
+	for i := range shards {
+		s.shardsDone.Go(func() { s.runShard(i) })
+	}
+	for range workers {
+		s.workersDone.Go(s.runWorker)
+	}
+	return s, nil
+}
+
+func (s *Sharded) runWorker() {
+	p := newParser(s.opts.DistinctField)
+	for rawRecord := range s.work {
+		r := new(Record)
+		if err := p.parse(rawRecord, r); err != nil {
+			s.malformed.Add(1)
+			s.pending.Done()
+			continue
+		}
+		s.shardIn[maphash.String(s.seed, r.Host)%uint64(len(s.shardIn))] <- r
+	}
+}
+
+func (s *Sharded) runShard(i int) {
+	for r := range s.shardIn[i] {
+		s.shards[i].addRecord(r)
+		s.pending.Done()
+	}
+}
+
+// Aggregate queues rawRecord and returns immediately, parse errors are
+// counted and reported through Malformed instead.
+func (s *Sharded) Aggregate(rawRecord []byte) error {
+	s.merged = nil
+	s.pending.Add(1)
+	s.work <- rawRecord
+	return nil
+}
+
+func (s *Sharded) Malformed() int {
+	return int(s.malformed.Load())
+}
+
+// Format waits for every queued record to be aggregated, then renders the
+// merged shards. Shards are idle while merging since only the caller
+// goroutine feeds them.
+func (s *Sharded) Format(asOf time.Time) string {
+	return s.merge().Format(asOf)
+}
+
+func (s *Sharded) FormatMarked(asOf time.Time, marks map[string]string) string {
+	return s.merge().FormatMarked(asOf, marks)
+}
+
+func (s *Sharded) Rows() []Row {
+	return s.merge().Rows()
+}
+
+func (s *Sharded) Overflow() int {
+	return s.merge().Overflow()
+}
+
+func (s *Sharded) SLOs() []SLOStatus {
+	return s.merge().SLOs()
+}
+
+// merge is computed once per batch of records, so a tick reading rows,
+// overflow and SLOs clones the sketches once.
+func (s *Sharded) merge() *Aggregator {
+	if s.merged != nil {
+		return s.merged
+	}
+	s.pending.Wait()
+
+	// never aggregated into directly, so no lru bookkeeping needed
+	merged := &Aggregator{opts: s.opts, groups: NewSummaries()}
+	for _, shard := range s.shards {
+		// sketches of one host never span shards, precision always matches
+		merged.groups.Merge(shard.groups)
+		merged.overflow += shard.overflow
+	}
+	// every shard counts the records of its hosts against every SLO
+	for i, slo := range s.opts.SLOs {
+		t := newSLOTracker(slo, s.opts.Clock)
+		for _, shard := range s.shards {
+			t.merge(shard.slos[i])
+		}
+		merged.slos = append(merged.slos, t)
+	}
+	s.merged = merged
+	return merged
+}
+
+// Close stops the worker and shard goroutines. Records queued before Close
+// are still aggregated.
+func (s *Sharded) Close() {
+	close(s.work)
+	s.workersDone.Wait()
+	for _, in := range s.shardIn {
+		close(in)
+	}
+	s.shardsDone.Wait()
+}
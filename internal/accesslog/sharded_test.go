@@ -0,0 +1,155 @@
+package accesslog
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readTestLog(t testing.TB) [][]byte {
+	t.Helper()
+	raw, err := os.ReadFile("../../test/testdata/log.log")
+	if err != nil {
+		t.Fatalf("read test log: %v", err)
+	}
+	var lines [][]byte
+	sc := bufio.NewScanner(bytes.NewReader(raw))
+	for sc.Scan() {
+		lines = append(lines, append([]byte(nil), sc.Bytes()...))
+	}
+	return lines
+}
+
+func TestSharded_MatchesAggregator(t *testing.T) {
+	lines := readTestLog(t)
+	lines = append(lines, []byte("not json"), []byte(`{"host":"missing.fields"}`))
+
+	want, _ := NewAggregator(Options{})
+	wantMalformed := 0
+	for _, l := range lines {
+		if err := want.Aggregate(l); err != nil {
+			wantMalformed++
+		}
+	}
+
+	for _, workers := range []int{1, 2, 8} {
+		t.Run("workers="+strconv.Itoa(workers), func(t *testing.T) {
+			s, err := NewSharded(Options{}, workers, workers)
+			if err != nil {
+				t.Fatalf("NewSharded() error = %v", err)
+			}
+			defer s.Close()
+
+			for _, l := range lines {
+				s.Aggregate(l)
+			}
+
+			// skip the "as of" line, it carries the wall clock
+			got := strings.SplitN(s.Format(time.Now()), "\n", 3)[2]
+			exp := strings.SplitN(want.Format(time.Now()), "\n", 3)[2]
+			if got != exp {
+				t.Errorf("Format() differs from single aggregator\ngot:\n%s\nwant:\n%s", got, exp)
+			}
+			if s.Malformed() != wantMalformed {
+				t.Errorf("Malformed() = %d, want %d", s.Malformed(), wantMalformed)
+			}
+		})
+	}
+}
+
+func TestSharded_DistinctAndOverflow(t *testing.T) {
+	s, err := NewSharded(Options{DistinctField: "client_ip", MaxGroups: 4, Overflow: OverflowOther}, 4, 2)
+	if err != nil {
+		t.Fatalf("NewSharded() error = %v", err)
+	}
+	defer s.Close()
+
+	for i := range 20 {
+		host := "h" + strconv.Itoa(i%10)
+		s.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"` + host + `","status_code":200,"duration":0.1,"client_ip":"10.0.0.` + strconv.Itoa(i) + `"}`))
+	}
+
+	got := s.Format(time.Now())
+	if !strings.Contains(got, "uniq_client_ip") {
+		t.Errorf("Format() missing distinct column: %s", got)
+	}
+	if !strings.Contains(got, OtherGroup) || !strings.Contains(got, "group limit 4 reached") {
+		t.Errorf("Format() missing overflow accounting: %s", got)
+	}
+}
+
+func TestNewSharded_Invalid(t *testing.T) {
+	if _, err := NewSharded(Options{}, 0, 1); err == nil {
+		t.Error("NewSharded() with 0 workers should fail")
+	}
+	if _, err := NewSharded(Options{DistinctField: "ip", DistinctPrecision: 30}, 1, 1); err == nil {
+		t.Error("NewSharded() with invalid precision should fail")
+	}
+	if _, err := NewSharded(Options{MaxGroups: 3}, 4, 4); err == nil {
+		t.Error("NewSharded() with fewer groups than shards should fail")
+	}
+}
+
+func TestSharded_MaxGroupsSplit(t *testing.T) {
+	s, err := NewSharded(Options{MaxGroups: 10, Overflow: OverflowEvict}, 4, 4)
+	if err != nil {
+		t.Fatalf("NewSharded() error = %v", err)
+	}
+	defer s.Close()
+
+	total := 0
+	for _, shard := range s.shards {
+		total += shard.opts.MaxGroups
+	}
+	if total != 10 {
+		t.Errorf("shard limits sum to %d, want 10", total)
+	}
+}
+
+func TestSharded_MergeOncePerBatch(t *testing.T) {
+	s, err := NewSharded(Options{}, 2, 2)
+	if err != nil {
+		t.Fatalf("NewSharded() error = %v", err)
+	}
+	defer s.Close()
+
+	s.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}`))
+	first := s.merge()
+	if s.merge() != first {
+		t.Error("merge() without new records should reuse the merged shards")
+	}
+	s.Aggregate([]byte(`{"time":"2025-08-14T02:07:13Z","host":"b.com","status_code":200,"duration":0.1}`))
+	if rows := s.Rows(); len(rows) != 2 {
+		t.Errorf("Rows() after a new record = %d rows, want 2", len(rows))
+	}
+}
+
+func BenchmarkAggregator(b *testing.B) {
+	lines := readTestLog(b)
+	a, _ := NewAggregator(Options{})
+	b.ResetTimer()
+	for i := range b.N {
+		a.Aggregate(lines[i%len(lines)])
+	}
+	a.Format(time.Now())
+}
+
+func BenchmarkSharded(b *testing.B) {
+	lines := readTestLog(b)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			s, _ := NewSharded(Options{}, workers, workers)
+			defer s.Close()
+			b.ResetTimer()
+			for i := range b.N {
+				s.Aggregate(lines[i%len(lines)])
+			}
+			// wait for the pipeline to drain
+			s.Format(time.Now())
+		})
+	}
+}
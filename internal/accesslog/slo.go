@@ -0,0 +1,261 @@
+package accesslog
+
+import (
+	"accessAggregator/internal/clock"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SLO is an availability objective over the records of the hosts it
+// selects. A record is good when its status is 2xx or 3xx and, if Latency
+// is set, its duration is below Latency.
+type SLO struct {
+	Name    string
+	Hosts   *regexp.Regexp // nil selects every host
+	Target  float64        // wanted share of good records, e.g. 0.999
+	Latency time.Duration  // 0 ignores the duration
+	Window  time.Duration  // error budget period, defaults to 30 days
+}
+
+// windows the burn rate is reported over
+var BurnWindows = [3]time.Duration{time.Hour, 6 * time.Hour, 72 * time.Hour}
+
+const defaultSLOWindow = 30 * 24 * time.Hour
+
+// records further ahead of Options.Clock are skipped by SLOs, one bogus
+// timestamp would otherwise age out the whole window
+const maxSLOSkew = time.Hour
+
+// ParseSLO reads space separated key=value pairs, target in percent:
+//
+//	name=api hosts=api\..* target=99.9 latency=300ms window=30d
+//
+// hosts is a regular expression matching whole host names.
+func ParseSLO(s string) (SLO, error) {
+	slo := SLO{Window: defaultSLOWindow}
+	for _, kv := range strings.Fields(s) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return SLO{}, fmt.Errorf("invalid slo %q: want key=value, got %q", s, kv)
+		}
+		var err error
+		switch k {
+		case "name":
+			slo.Name = v
+		case "hosts":
+			slo.Hosts, err = regexp.Compile("^(?:" + v + ")$")
+		case "target":
+			var pct float64
+			pct, err = strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			if err == nil && (pct <= 0 || pct >= 100) {
+				err = fmt.Errorf("target %v%% must be between 0 and 100", pct)
+			}
+			slo.Target = pct / 100
+		case "latency":
+			slo.Latency, err = time.ParseDuration(v)
+		case "window":
+			slo.Window, err = parseWindow(v)
+		default:
+			err = fmt.Errorf("unknown key %q", k)
+		}
+		if err != nil {
+			return SLO{}, fmt.Errorf("invalid slo %q: %w", s, err)
+		}
+	}
+
+	if slo.Name == "" || slo.Target == 0 {
+		return SLO{}, fmt.Errorf("invalid slo %q: name and target are required", s)
+	}
+	return slo, nil
+}
+
+// parseWindow is time.ParseDuration plus a d suffix for days
+func parseWindow(v string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err == nil && d < time.Minute {
+		err = fmt.Errorf("window %s shorter than a minute", v)
+	}
+	return d, err
+}
+
+func (s *SLO) good(r *Record) bool {
+	if r.StatusCode < 200 || r.StatusCode >= 400 {
+		return false
+	}
+	return s.Latency == 0 || r.Duration < s.Latency.Seconds()
+}
+
+// SLOStatus is where an SLO stands, measured at the time of the newest
+// record it counted.
+type SLOStatus struct {
+	Name   string  `json:"name"`
+	Target float64 `json:"target"`
+	// over the SLO window
+	Good  int64 `json:"good"`
+	Total int64 `json:"total"`
+	// share of the error budget left, negative once it is exhausted
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// how fast the budget burns over each of BurnWindows, 1 spends exactly
+	// the budget over the SLO window
+	Burn1h float64 `json:"burn_1h"`
+	Burn6h float64 `json:"burn_6h"`
+	Burn3d float64 `json:"burn_3d"`
+}
+
+// sloBucket counts the records of one minute, by record time
+type sloBucket struct {
+	minute      int64
+	good, total int64
+}
+
+type sloTracker struct {
+	slo     SLO
+	clk     clock.Clock
+	buckets []sloBucket // ascending by minute
+	keep    int64       // minutes of buckets kept, the longest window
+}
+
+func newSLOTracker(slo SLO, clk clock.Clock) *sloTracker {
+	keep := max(slo.Window, BurnWindows[len(BurnWindows)-1])
+	return &sloTracker{slo: slo, clk: clk, keep: int64(keep / time.Minute)}
+}
+
+func (t *sloTracker) add(r *Record) {
+	if t.slo.Hosts != nil && !t.slo.Hosts.MatchString(r.Host) {
+		return
+	}
+	if r.Time.After(t.clk.Now().Add(maxSLOSkew)) {
+		return
+	}
+	var good int64
+	if t.slo.good(r) {
+		good = 1
+	}
+	t.addBucket(sloBucket{minute: r.Time.Unix() / 60, good: good, total: 1})
+}
+
+// addBucket adds b into the bucket of its minute. Records come mostly in
+// time order, so the search starts from the newest bucket.
+func (t *sloTracker) addBucket(b sloBucket) {
+	i := len(t.buckets)
+	for i > 0 && t.buckets[i-1].minute > b.minute {
+		i--
+	}
+	switch {
+	case i > 0 && t.buckets[i-1].minute == b.minute:
+		t.buckets[i-1].good += b.good
+		t.buckets[i-1].total += b.total
+	case len(t.buckets) > 0 && b.minute <= t.latest()-t.keep:
+		// older than anything still reported
+	default:
+		t.buckets = append(t.buckets, sloBucket{})
+		copy(t.buckets[i+1:], t.buckets[i:])
+		t.buckets[i] = b
+	}
+	t.prune()
+}
+
+func (t *sloTracker) prune() {
+	if len(t.buckets) == 0 {
+		return
+	}
+	drop := 0
+	for drop < len(t.buckets) && t.buckets[drop].minute <= t.latest()-t.keep {
+		drop++
+	}
+	t.buckets = t.buckets[drop:]
+}
+
+func (t *sloTracker) latest() int64 {
+	return t.buckets[len(t.buckets)-1].minute
+}
+
+// merge folds the buckets of o into t, both sorted, in one pass
+func (t *sloTracker) merge(o *sloTracker) {
+	merged := make([]sloBucket, 0, len(t.buckets)+len(o.buckets))
+	a, b := t.buckets, o.buckets
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0].minute < b[0].minute:
+			merged, a = append(merged, a[0]), a[1:]
+		case len(a) == 0 || b[0].minute < a[0].minute:
+			merged, b = append(merged, b[0]), b[1:]
+		default:
+			sum := a[0]
+			sum.good += b[0].good
+			sum.total += b[0].total
+			merged, a, b = append(merged, sum), a[1:], b[1:]
+		}
+	}
+	t.buckets = merged
+	t.prune()
+}
+
+// counts sums the buckets of the last d up to the newest one
+func (t *sloTracker) counts(d time.Duration) (good, total int64) {
+	if len(t.buckets) == 0 {
+		return 0, 0
+	}
+	from := t.latest() - int64(d/time.Minute)
+	i := sort.Search(len(t.buckets), func(i int) bool { return t.buckets[i].minute > from })
+	for _, b := range t.buckets[i:] {
+		good += b.good
+		total += b.total
+	}
+	return good, total
+}
+
+func (t *sloTracker) status() SLOStatus {
+	st := SLOStatus{Name: t.slo.Name, Target: t.slo.Target}
+	st.Good, st.Total = t.counts(t.slo.Window)
+	st.BudgetRemaining = 1 - t.burn(st.Good, st.Total)
+
+	var burns [len(BurnWindows)]float64
+	for i, w := range BurnWindows {
+		burns[i] = t.burn(t.counts(w))
+	}
+	st.Burn1h, st.Burn6h, st.Burn3d = burns[0], burns[1], burns[2]
+	return st
+}
+
+// burn is the bad ratio as a multiple of the allowed bad ratio
+func (t *sloTracker) burn(good, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(total-good) / float64(total) / (1 - t.slo.Target)
+}
+
+func formatSLOs(statuses []SLOStatus, slos []SLO) string {
+	var b strings.Builder
+	for i, st := range statuses {
+		slo := slos[i]
+		criteria := "2xx/3xx"
+		if slo.Latency > 0 {
+			criteria += " under " + slo.Latency.String()
+		}
+		fmt.Fprintf(&b, "SLO %s: %s%% %s over %s, good %d/%d, budget left %.1f%%, burn rate 1h %.2f 6h %.2f 3d %.2f\n",
+			st.Name, strconv.FormatFloat(st.Target*100, 'f', -1, 64), criteria, formatWindow(slo.Window),
+			st.Good, st.Total, st.BudgetRemaining*100, st.Burn1h, st.Burn6h, st.Burn3d)
+	}
+	return b.String()
+}
+
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return d.String()
+}
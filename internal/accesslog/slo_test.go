@@ -0,0 +1,172 @@
+package accesslog
+
+import (
+	"accessAggregator/internal/clock"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSLO(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      SLO
+		wantHost  string
+		wantError string
+	}{
+		{
+			name:     "every key",
+			in:       `name=api hosts=api\..* target=99.5% latency=300ms window=7d`,
+			want:     SLO{Name: "api", Target: 0.995, Latency: 300 * time.Millisecond, Window: 7 * 24 * time.Hour},
+			wantHost: "api.a.com",
+		},
+		{
+			name: "defaults",
+			in:   "name=all target=99",
+			want: SLO{Name: "all", Target: 0.99, Window: defaultSLOWindow},
+		},
+		{name: "missing target", in: "name=api", wantError: "name and target are required"},
+		{name: "target out of range", in: "name=api target=100", wantError: "between 0 and 100"},
+		{name: "unknown key", in: "name=api target=99 budget=1", wantError: `unknown key "budget"`},
+		{name: "not key value", in: "name=api 99.9", wantError: "want key=value"},
+		{name: "short window", in: "name=api target=99 window=10s", wantError: "shorter than a minute"},
+		{name: "bad regex", in: "name=api target=99 hosts=(", wantError: "missing closing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSLO(tt.in)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("ParseSLO() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSLO() error = %v", err)
+			}
+			hosts := got.Hosts
+			got.Hosts = nil
+			if got != tt.want {
+				t.Errorf("ParseSLO() = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantHost != "" && (!hosts.MatchString(tt.wantHost) || hosts.MatchString("x"+tt.wantHost)) {
+				t.Errorf("hosts %v does not select exactly %q", hosts, tt.wantHost)
+			}
+		})
+	}
+}
+
+func sloRecord(at time.Time, host string, status int, duration float64) []byte {
+	return []byte(fmt.Sprintf(`{"time":%q,"host":%q,"status_code":%d,"duration":%v}`, at.Format(time.RFC3339), host, status, duration))
+}
+
+func TestAggregator_SLO(t *testing.T) {
+	slo, _ := ParseSLO(`name=api hosts=api\..* target=99 latency=300ms window=1d`)
+	a, err := NewAggregator(Options{SLOs: []SLO{slo}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)
+	// just over 3 days ago, outside every window
+	for range 100 {
+		a.Aggregate(sloRecord(start, "api.a.com", 500, 0.1))
+	}
+	now := start.Add(72*time.Hour + time.Minute)
+	// 2 hours ago: 1 bad of 100, counted in 6h and 3d
+	for i := range 100 {
+		status := 200
+		if i == 0 {
+			status = 503
+		}
+		a.Aggregate(sloRecord(now.Add(-2*time.Hour), "api.a.com", status, 0.1))
+	}
+	// last hour: a slow and a failing record out of 100, plus other hosts
+	for i := range 100 {
+		switch i {
+		case 0:
+			a.Aggregate(sloRecord(now, "api.a.com", 200, 0.5))
+		case 1:
+			a.Aggregate(sloRecord(now, "api.a.com", 404, 0.1))
+		default:
+			a.Aggregate(sloRecord(now, "api.b.com", 301, 0.1))
+		}
+		a.Aggregate(sloRecord(now, "www.a.com", 500, 0.1))
+	}
+
+	got := a.SLOs()
+	if len(got) != 1 {
+		t.Fatalf("SLOs() = %+v", got)
+	}
+	st := got[0]
+	if st.Good != 197 || st.Total != 200 {
+		t.Errorf("good/total = %d/%d, want 197/200 within the 1d window", st.Good, st.Total)
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	// 1.5% bad against a 1% budget
+	if !near(st.BudgetRemaining, -0.5) {
+		t.Errorf("BudgetRemaining = %v, want -0.5", st.BudgetRemaining)
+	}
+	if !near(st.Burn1h, 2) || !near(st.Burn6h, 1.5) || !near(st.Burn3d, 1.5) {
+		t.Errorf("burn rates = %v %v %v, want 2 1.5 1.5", st.Burn1h, st.Burn6h, st.Burn3d)
+	}
+
+	if out := a.Format(now); !strings.Contains(out, "SLO api: 99% 2xx/3xx under 300ms over 1d, good 197/200, budget left -50.0%, burn rate 1h 2.00 6h 1.50 3d 1.50") {
+		t.Errorf("Format() missing SLO line:\n%s", out)
+	}
+}
+
+func TestAggregator_SLOSkipsFutureRecords(t *testing.T) {
+	slo, _ := ParseSLO("name=all target=99")
+	// a replay of an old log runs on a clock at its record times
+	now := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	a, err := NewAggregator(Options{SLOs: []SLO{slo}, Clock: clk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Aggregate(sloRecord(now, "a.com", 200, 0.1))
+	a.Aggregate(sloRecord(now.AddDate(100, 0, 0), "a.com", 200, 0.1))
+	a.Aggregate(sloRecord(now.Add(time.Minute), "a.com", 500, 0.1))
+	a.Aggregate(sloRecord(now.Add(2*time.Hour), "a.com", 200, 0.1))
+	clk.Advance(2 * time.Hour)
+	a.Aggregate(sloRecord(now.Add(2*time.Hour), "a.com", 200, 0.1))
+
+	st := a.SLOs()[0]
+	if st.Good != 2 || st.Total != 3 {
+		t.Errorf("good/total = %d/%d, want 2/3 with the records ahead of the clock skipped", st.Good, st.Total)
+	}
+	if got := a.Rows(); got[0].Requests != 5 {
+		t.Errorf("Rows() counted %d requests, want 5, only the SLO skips them", got[0].Requests)
+	}
+}
+
+func TestSharded_SLO(t *testing.T) {
+	slo, _ := ParseSLO("name=all target=90")
+	opts := Options{SLOs: []SLO{slo}}
+	want, _ := NewAggregator(opts)
+	s, err := NewSharded(opts, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Date(2025, 8, 14, 0, 0, 0, 0, time.UTC)
+	for i := range 500 {
+		status := 200
+		if i%7 == 0 {
+			status = 500
+		}
+		rec := sloRecord(start.Add(time.Duration(i)*time.Minute), fmt.Sprintf("h%d.com", i%13), status, 0.1)
+		want.Aggregate(rec)
+		s.Aggregate(rec)
+	}
+
+	if got, exp := s.SLOs(), want.SLOs(); got[0] != exp[0] {
+		t.Errorf("sharded SLOs() = %+v, want %+v", got[0], exp[0])
+	}
+}
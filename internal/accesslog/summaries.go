@@ -1,5 +1,11 @@
 package accesslog
 
+import (
+	"accessAggregator/internal/hll"
+	"fmt"
+	"time"
+)
+
 func (s *summary) updateSummary(newRecord *Record) {
 	s.durationTotal = s.durationTotal + newRecord.Duration
 
@@ -7,6 +13,12 @@ func (s *summary) updateSummary(newRecord *Record) {
 		s.request2xx++
 	}
 
+	s.byClass[StatusClass(newRecord.StatusCode)]++
+
+	if s.distinct != nil && newRecord.Distinct != "" {
+		s.distinct.AddString(newRecord.Distinct)
+	}
+
 	s.requestTotal++
 }
 
@@ -16,12 +28,156 @@ func (ss Summaries) Aggregate(rawRecord []byte) error {
 		return err
 	}
 
+	ss.add(newRecord, nil)
+	return nil
+}
+
+// add folds newRecord into its host, newSummary builds the zero value for
+// hosts not seen before
+func (ss Summaries) add(newRecord *Record, newSummary func() summary) {
 	s, ok := ss[newRecord.Host]
-	if !ok {
-		s = summary{}
+	if !ok && newSummary != nil {
+		s = newSummary()
 	}
 	// wether it new or not, it still need to update
 	s.updateSummary(newRecord)
 	ss[newRecord.Host] = s
+}
+
+func (a *Aggregator) Aggregate(rawRecord []byte) error {
+	var newRecord Record
+	if err := a.parser.parse(rawRecord, &newRecord); err != nil {
+		return err
+	}
+
+	a.addRecord(&newRecord)
+	return nil
+}
+
+func (a *Aggregator) addRecord(newRecord *Record) {
+	// before limit, which may rename the host to OtherGroup
+	for _, t := range a.slos {
+		t.add(newRecord)
+	}
+	a.limit(newRecord)
+	a.groups.add(newRecord, a.newSummary)
+}
+
+// limit enforces MaxGroups before newRecord is added, either by renaming its
+// host to OtherGroup or by evicting the least recently seen host
+func (a *Aggregator) limit(newRecord *Record) {
+	if a.opts.MaxGroups == 0 {
+		return
+	}
+	_, known := a.groups[newRecord.Host]
+
+	switch a.opts.Overflow {
+	case OverflowOther:
+		// OtherGroup itself does not count against the limit
+		n := len(a.groups)
+		if _, ok := a.groups[OtherGroup]; ok {
+			n--
+		}
+		if !known && n >= a.opts.MaxGroups {
+			newRecord.Host = OtherGroup
+			a.overflow++
+		}
+	case OverflowEvict:
+		if known {
+			a.lru.MoveToFront(a.lruElem[newRecord.Host])
+			return
+		}
+		if len(a.groups) >= a.opts.MaxGroups {
+			oldest := a.lru.Back()
+			host := a.lru.Remove(oldest).(string)
+			delete(a.lruElem, host)
+			delete(a.groups, host)
+			a.overflow++
+		}
+		a.lruElem[newRecord.Host] = a.lru.PushFront(newRecord.Host)
+	}
+}
+
+func (a *Aggregator) newSummary() summary {
+	var s summary
+	if a.opts.DistinctField != "" {
+		// precision already validated by NewAggregator
+		s.distinct, _ = hll.New(a.opts.DistinctPrecision)
+	}
+	return s
+}
+
+func (a *Aggregator) Format(asOf time.Time) string {
+	return a.FormatMarked(asOf, nil)
+}
+
+func (a *Aggregator) FormatMarked(asOf time.Time, marks map[string]string) string {
+	out := formatRows(asOf, a.opts.View.Apply(a.groups.Rows()), a.opts.View.columns(a.opts.DistinctField), marks)
+	if a.overflow > 0 {
+		switch a.opts.Overflow {
+		case OverflowOther:
+			out += fmt.Sprintf("group limit %d reached, records folded into %s: %d\n", a.opts.MaxGroups, OtherGroup, a.overflow)
+		case OverflowEvict:
+			out += fmt.Sprintf("group limit %d reached, least recently seen hosts evicted: %d\n", a.opts.MaxGroups, a.overflow)
+		}
+	}
+	if len(a.slos) > 0 {
+		out += formatSLOs(a.SLOs(), a.opts.SLOs)
+	}
+	return out
+}
+
+func (ss Summaries) Rows() []Row {
+	hosts := ss.sort()
+	rows := make([]Row, len(hosts))
+	for i, h := range hosts {
+		s := ss[h]
+		rows[i] = Row{Host: h, Requests: s.requestTotal, Requests2xx: s.request2xx, DurationTotal: s.durationTotal, ByClass: s.byClass}
+		if s.distinct != nil {
+			rows[i].Distinct = s.distinct.Estimate()
+		}
+	}
+	return rows
+}
+
+func (a *Aggregator) Rows() []Row {
+	return a.groups.Rows()
+}
+
+// Overflow is the number of records folded into OtherGroup, or of hosts
+// evicted, depending on Options.Overflow.
+func (a *Aggregator) Overflow() int {
+	return a.overflow
+}
+
+// SLOs reports every Options.SLOs in order.
+func (a *Aggregator) SLOs() []SLOStatus {
+	statuses := make([]SLOStatus, len(a.slos))
+	for i, t := range a.slos {
+		statuses[i] = t.status()
+	}
+	return statuses
+}
+
+// Merge folds other into ss, host by host. Distinct sketches are merged as
+// well, so the unique count of the result is that of the union.
+func (ss Summaries) Merge(other Summaries) error {
+	for h, o := range other {
+		s := ss[h]
+		s.requestTotal += o.requestTotal
+		s.request2xx += o.request2xx
+		s.durationTotal += o.durationTotal
+		for c, n := range o.byClass {
+			s.byClass[c] += n
+		}
+		if o.distinct != nil {
+			if s.distinct == nil {
+				s.distinct = o.distinct.Clone()
+			} else if err := s.distinct.Merge(o.distinct); err != nil {
+				return err
+			}
+		}
+		ss[h] = s
+	}
 	return nil
 }
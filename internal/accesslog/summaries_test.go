@@ -2,6 +2,7 @@ package accesslog
 
 import (
 	"math"
+	"strings"
 	"testing"
 	"time"
 )
@@ -215,17 +216,17 @@ func TestSummaries_Aggregate(t *testing.T) {
 		{name: "new host on empty summaries",
 			summaries: Summaries{},
 			rawRecord: []byte(`{"time":"2025-08-14T02:07:12.680651416Z","host":"chatgpt.com","status_code":299,"duration":0.224254673}`),
-			want:      Summaries{"chatgpt.com": {requestTotal: 1, request2xx: 1, durationTotal: 0.224254673}},
+			want:      Summaries{"chatgpt.com": {requestTotal: 1, request2xx: 1, durationTotal: 0.224254673, byClass: [6]int{2: 1}}},
 		},
 		{name: "existing host on existing summaries",
 			summaries: Summaries{"chatgpt.com": {requestTotal: 1, request2xx: 1, durationTotal: 0.224254673}},
 			rawRecord: []byte(`{"time":"2025-08-14T02:07:12.680651416Z","host":"chatgpt.com","status_code":300,"duration":0.224254673}`),
-			want:      Summaries{"chatgpt.com": {requestTotal: 2, request2xx: 1, durationTotal: 0.448509346}},
+			want:      Summaries{"chatgpt.com": {requestTotal: 2, request2xx: 1, durationTotal: 0.448509346, byClass: [6]int{3: 1}}},
 		},
 		{name: "new host on existing summaries",
 			summaries: Summaries{"chatgpt.com": {requestTotal: 1, request2xx: 1, durationTotal: 0.224254673}},
 			rawRecord: []byte(`{"time":"2025-08-14T02:07:12.680651416Z","host":"substrate.office.com","status_code":300,"duration":0.224254673}`),
-			want:      Summaries{"chatgpt.com": {requestTotal: 1, request2xx: 1, durationTotal: 0.224254673}, "substrate.office.com": {requestTotal: 1, request2xx: 0, durationTotal: 0.224254673}},
+			want:      Summaries{"chatgpt.com": {requestTotal: 1, request2xx: 1, durationTotal: 0.224254673}, "substrate.office.com": {requestTotal: 1, request2xx: 0, durationTotal: 0.224254673, byClass: [6]int{3: 1}}},
 		},
 	}
 	for _, tt := range tests {
@@ -247,3 +248,169 @@ func TestSummaries_Aggregate(t *testing.T) {
 		})
 	}
 }
+
+func TestAggregator_Distinct(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       Options
+		rawRecords []string
+		want       map[string]uint64 // host -> unique count
+	}{
+		{
+			name: "unique client ips per host",
+			opts: Options{DistinctField: "client_ip"},
+			rawRecords: []string{
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`,
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`,
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":500,"duration":0.1,"client_ip":"10.0.0.2"}`,
+				`{"time":"2025-08-14T02:07:12Z","host":"b.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`,
+			},
+			want: map[string]uint64{"a.com": 2, "b.com": 1},
+		},
+		{
+			name: "missing and non string field values",
+			opts: Options{DistinctField: "user_id"},
+			rawRecords: []string{
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"user_id":42}`,
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"user_id":"42"}`,
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}`,
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"user_id":null}`,
+			},
+			want: map[string]uint64{"a.com": 1},
+		},
+		{
+			name: "disabled keeps sketches nil",
+			opts: Options{},
+			rawRecords: []string{
+				`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`,
+			},
+			want: map[string]uint64{"a.com": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAggregator(tt.opts)
+			if err != nil {
+				t.Fatalf("NewAggregator() error = %v", err)
+			}
+			for _, r := range tt.rawRecords {
+				if err := a.Aggregate([]byte(r)); err != nil {
+					t.Fatalf("Aggregate() error = %v", err)
+				}
+			}
+			for host, want := range tt.want {
+				s := a.groups[host]
+				var got uint64
+				if s.distinct != nil {
+					got = s.distinct.Estimate()
+				}
+				if got != want {
+					t.Errorf("host %q unique = %d, want %d", host, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSummaries_Merge(t *testing.T) {
+	a, _ := NewAggregator(Options{DistinctField: "client_ip"})
+	b, _ := NewAggregator(Options{DistinctField: "client_ip"})
+	a.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1,"client_ip":"10.0.0.1"}`))
+	b.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":404,"duration":0.3,"client_ip":"10.0.0.2"}`))
+	b.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"b.com","status_code":200,"duration":0.2,"client_ip":"10.0.0.1"}`))
+
+	merged := NewSummaries()
+	if err := merged.Merge(a.groups); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if err := merged.Merge(b.groups); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+
+	if got := merged["a.com"]; got.requestTotal != 2 || got.request2xx != 1 || math.Abs(got.durationTotal-0.4) > 1e-9 {
+		t.Errorf("a.com merged = %+v", got)
+	}
+	if got := merged["a.com"].distinct.Estimate(); got != 2 {
+		t.Errorf("a.com unique = %d, want 2", got)
+	}
+	if got := merged["b.com"].requestTotal; got != 1 {
+		t.Errorf("b.com requestTotal = %d, want 1", got)
+	}
+	// merging must not alias the source sketch
+	if merged["b.com"].distinct == b.groups["b.com"].distinct {
+		t.Error("Merge() shares sketch with source")
+	}
+}
+
+func TestAggregator_MaxGroups(t *testing.T) {
+	rec := func(host string) []byte {
+		return []byte(`{"time":"2025-08-14T02:07:12Z","host":"` + host + `","status_code":200,"duration":0.1}`)
+	}
+
+	tests := []struct {
+		name         string
+		opts         Options
+		hosts        []string
+		wantHosts    map[string]int // host -> requestTotal
+		wantOverflow int
+	}{
+		{
+			name:         "unlimited",
+			opts:         Options{},
+			hosts:        []string{"a", "b", "c"},
+			wantHosts:    map[string]int{"a": 1, "b": 1, "c": 1},
+			wantOverflow: 0,
+		},
+		{
+			name:         "fold into other",
+			opts:         Options{MaxGroups: 2, Overflow: OverflowOther},
+			hosts:        []string{"a", "b", "c", "a", "d", "c"},
+			wantHosts:    map[string]int{"a": 2, "b": 1, OtherGroup: 3},
+			wantOverflow: 3,
+		},
+		{
+			name:         "evict least recently seen",
+			opts:         Options{MaxGroups: 2, Overflow: OverflowEvict},
+			hosts:        []string{"a", "b", "a", "c", "d"},
+			wantHosts:    map[string]int{"c": 1, "d": 1},
+			wantOverflow: 2,
+		},
+		{
+			name:         "evict keeps recently touched host",
+			opts:         Options{MaxGroups: 2, Overflow: OverflowEvict},
+			hosts:        []string{"a", "b", "a", "c", "a"},
+			wantHosts:    map[string]int{"a": 3, "c": 1},
+			wantOverflow: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAggregator(tt.opts)
+			if err != nil {
+				t.Fatalf("NewAggregator() error = %v", err)
+			}
+			for _, h := range tt.hosts {
+				if err := a.Aggregate(rec(h)); err != nil {
+					t.Fatalf("Aggregate() error = %v", err)
+				}
+			}
+
+			if len(a.groups) != len(tt.wantHosts) {
+				t.Errorf("got %d groups, want %d: %v", len(a.groups), len(tt.wantHosts), a.groups)
+			}
+			for h, want := range tt.wantHosts {
+				if got := a.groups[h].requestTotal; got != want {
+					t.Errorf("host %q requestTotal = %d, want %d", h, got, want)
+				}
+			}
+			if a.overflow != tt.wantOverflow {
+				t.Errorf("overflow = %d, want %d", a.overflow, tt.wantOverflow)
+			}
+			if hasFooter := strings.Contains(a.Format(time.Now()), "group limit"); hasFooter != (tt.wantOverflow > 0) {
+				t.Errorf("Format() overflow footer present = %v, want %v", hasFooter, tt.wantOverflow > 0)
+			}
+		})
+	}
+}
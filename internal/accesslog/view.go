@@ -0,0 +1,178 @@
+package accesslog
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OthersRow holds the hosts cut by View.Top, summed.
+const OthersRow = "__others__"
+
+type SortKey int
+
+const (
+	SortHost SortKey = iota
+	SortTotal
+	SortErrors     // 5xx responses
+	SortErrorRatio // 5xx share of requests
+	SortAvgDuration
+)
+
+func ParseSortKey(s string) (SortKey, error) {
+	switch s {
+	case "host":
+		return SortHost, nil
+	case "total":
+		return SortTotal, nil
+	case "errors":
+		return SortErrors, nil
+	case "error_ratio":
+		return SortErrorRatio, nil
+	case "avg_duration":
+		return SortAvgDuration, nil
+	}
+	return 0, fmt.Errorf("unknown sort key %q: want host, total, errors, error_ratio or avg_duration", s)
+}
+
+func (k SortKey) value(r Row) float64 {
+	switch k {
+	case SortTotal:
+		return float64(r.Requests)
+	case SortErrors:
+		return float64(r.ByClass[5])
+	case SortErrorRatio:
+		return r.ErrorRatio()
+	case SortAvgDuration:
+		return r.AvgDuration()
+	}
+	return 0
+}
+
+// ErrorRatio is the share of 5xx responses.
+func (r Row) ErrorRatio() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.ByClass[5]) / float64(r.Requests)
+}
+
+// Column is one value column of the summary table.
+type Column struct {
+	Name   string // as given to -columns
+	header string
+	width  int
+	format func(r Row) string
+}
+
+// Columns lists what -columns can pick from, the first four are the
+// default. "uniq" only has values with a distinct field.
+var Columns = []Column{
+	{"total", "total_requests", 15, func(r Row) string { return strconv.Itoa(r.Requests) }},
+	{"2xx", "2xx_requests", 15, func(r Row) string { return strconv.Itoa(r.Requests2xx) }},
+	{"non_2xx", "non_2xx_requests", 18, func(r Row) string { return strconv.Itoa(r.Requests - r.Requests2xx) }},
+	{"avg_duration", "avg_duration_s", 18, func(r Row) string {
+		return strconv.FormatFloat(r.DurationTotal/float64(r.Requests), 'f', 3, 64)
+	}},
+	{"5xx", "5xx_requests", 15, func(r Row) string { return strconv.Itoa(r.ByClass[5]) }},
+	{"error_ratio", "error_ratio", 15, func(r Row) string { return strconv.FormatFloat(r.ErrorRatio(), 'f', 4, 64) }},
+	{"uniq", "uniq", 15, func(r Row) string { return strconv.FormatUint(r.Distinct, 10) }},
+}
+
+var defaultColumns = []string{"total", "2xx", "non_2xx", "avg_duration"}
+
+func ParseColumns(s string) ([]string, error) {
+	var cols []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.ContainsFunc(Columns, func(c Column) bool { return c.Name == name }) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		cols = append(cols, name)
+	}
+	return cols, nil
+}
+
+// View selects how rows are presented by every output: order, how many,
+// and for outputs with columns, which ones. The zero View is all hosts A
+// to Z with the default columns.
+type View struct {
+	Sort SortKey
+	Desc bool
+	// keep the first Top rows and sum the rest into OthersRow, 0 keeps all
+	Top     int
+	Columns []string // nil for the default columns
+}
+
+// Apply returns rows sorted and cut as v says, rows is not modified.
+func (v View) Apply(rows []Row) []Row {
+	out := slices.Clone(rows)
+	slices.SortStableFunc(out, func(a, b Row) int {
+		c := 0
+		if v.Sort != SortHost {
+			x, y := v.Sort.value(a), v.Sort.value(b)
+			switch {
+			case x < y:
+				c = -1
+			case x > y:
+				c = 1
+			}
+		} else {
+			c = strings.Compare(a.Host, b.Host)
+		}
+		if v.Desc {
+			c = -c
+		}
+		if c == 0 {
+			// ties stay A to Z either way
+			c = strings.Compare(a.Host, b.Host)
+		}
+		return c
+	})
+	return v.CutTop(out)
+}
+
+// CutTop keeps the first Top rows in their order and sums the rest into
+// OthersRow, for rows sorted elsewhere. rows is not modified.
+func (v View) CutTop(rows []Row) []Row {
+	if v.Top <= 0 || len(rows) <= v.Top {
+		return rows
+	}
+	others := Row{Host: OthersRow}
+	for _, r := range rows[v.Top:] {
+		others.Requests += r.Requests
+		others.Requests2xx += r.Requests2xx
+		others.DurationTotal += r.DurationTotal
+		for c, n := range r.ByClass {
+			others.ByClass[c] += n
+		}
+	}
+	return append(slices.Clone(rows[:v.Top]), others)
+}
+
+// columns resolves the selected columns, the default adds uniq when a
+// distinct field is set
+func (v View) columns(distinctField string) []Column {
+	names := v.Columns
+	if names == nil {
+		names = defaultColumns
+		if distinctField != "" {
+			names = append(slices.Clone(names), "uniq")
+		}
+	}
+	cols := make([]Column, 0, len(names))
+	for _, name := range names {
+		i := slices.IndexFunc(Columns, func(c Column) bool { return c.Name == name })
+		if i < 0 {
+			continue
+		}
+		c := Columns[i]
+		if c.Name == "uniq" && distinctField != "" {
+			c.header = "uniq_" + distinctField
+			c.width = max(len(c.header), c.width)
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
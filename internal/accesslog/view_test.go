@@ -0,0 +1,99 @@
+package accesslog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func hostsOf(rows []Row) []string {
+	hosts := make([]string, len(rows))
+	for i, r := range rows {
+		hosts[i] = r.Host
+	}
+	return hosts
+}
+
+func TestView_Apply(t *testing.T) {
+	rows := []Row{
+		{Host: "a.com", Requests: 10, DurationTotal: 1, ByClass: [6]int{2: 9, 5: 1}},
+		{Host: "b.com", Requests: 100, DurationTotal: 5, ByClass: [6]int{2: 98, 5: 2}},
+		{Host: "c.com", Requests: 4, DurationTotal: 4, ByClass: [6]int{5: 2, 2: 2}},
+		{Host: "d.com", Requests: 10, DurationTotal: 1, ByClass: [6]int{2: 10}},
+	}
+
+	tests := []struct {
+		name string
+		view View
+		want []string
+	}{
+		{name: "zero view is A to Z", view: View{}, want: []string{"a.com", "b.com", "c.com", "d.com"}},
+		{name: "host descending", view: View{Desc: true}, want: []string{"d.com", "c.com", "b.com", "a.com"}},
+		{name: "total, ties A to Z", view: View{Sort: SortTotal, Desc: true}, want: []string{"b.com", "a.com", "d.com", "c.com"}},
+		{name: "errors ascending", view: View{Sort: SortErrors}, want: []string{"d.com", "a.com", "b.com", "c.com"}},
+		{name: "error ratio", view: View{Sort: SortErrorRatio, Desc: true}, want: []string{"c.com", "a.com", "b.com", "d.com"}},
+		{name: "avg duration", view: View{Sort: SortAvgDuration, Desc: true}, want: []string{"c.com", "a.com", "d.com", "b.com"}},
+		{name: "top", view: View{Sort: SortTotal, Desc: true, Top: 2}, want: []string{"b.com", "a.com", OthersRow}},
+		{name: "top larger than rows", view: View{Top: 10}, want: []string{"a.com", "b.com", "c.com", "d.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.view.Apply(rows)
+			if !reflect.DeepEqual(hostsOf(got), tt.want) {
+				t.Errorf("Apply() = %v, want %v", hostsOf(got), tt.want)
+			}
+		})
+	}
+
+	got := View{Sort: SortTotal, Desc: true, Top: 2}.Apply(rows)
+	want := Row{Host: OthersRow, Requests: 14, DurationTotal: 5, ByClass: [6]int{2: 12, 5: 2}}
+	if got[2] != want {
+		t.Errorf("others row = %+v, want %+v", got[2], want)
+	}
+	if rows[0].Host != "a.com" || rows[1].Host != "b.com" {
+		t.Error("Apply() reordered its input")
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	got, err := ParseColumns("total, error_ratio,uniq")
+	if err != nil || !reflect.DeepEqual(got, []string{"total", "error_ratio", "uniq"}) {
+		t.Errorf("ParseColumns() = %v, %v", got, err)
+	}
+	if _, err := ParseColumns("total,latency"); err == nil || !strings.Contains(err.Error(), `"latency"`) {
+		t.Errorf("ParseColumns() error = %v, want unknown column", err)
+	}
+}
+
+func TestAggregator_FormatView(t *testing.T) {
+	a, err := NewAggregator(Options{View: View{Sort: SortTotal, Desc: true, Top: 1, Columns: []string{"total", "error_ratio"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []string{
+		`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":500,"duration":0.1}`,
+		`{"time":"2025-08-14T02:07:12Z","host":"b.com","status_code":200,"duration":0.1}`,
+		`{"time":"2025-08-14T02:07:12Z","host":"b.com","status_code":200,"duration":0.1}`,
+		`{"time":"2025-08-14T02:07:12Z","host":"c.com","status_code":200,"duration":0.1}`,
+	} {
+		a.Aggregate([]byte(rec))
+	}
+
+	lines := strings.Split(a.Format(time.Date(2025, 8, 14, 2, 7, 20, 0, time.UTC)), "\n")
+	want := []string{
+		"",
+		"*** Access Log Summary as of 2025-08-14 02:07:20 ***",
+		strings.Repeat("=", 46),
+		"Host          total_requests     error_ratio",
+		strings.Repeat("-", 46),
+		"b.com                      2          0.0000",
+		"__others__                 2          0.5000",
+		strings.Repeat("=", 46),
+		"",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Format() =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
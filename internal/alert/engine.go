@@ -0,0 +1,190 @@
+package alert
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/sink"
+	"fmt"
+	"time"
+)
+
+type State string
+
+const (
+	Firing   State = "firing"
+	Resolved State = "resolved"
+)
+
+// Event is a change of state of one rule for one host. Only changes are
+// emitted, a rule that keeps firing is not notified again.
+type Event struct {
+	Rule  string `json:"rule"`
+	Host  string `json:"host"`
+	State State  `json:"state"`
+	// the metrics of the rule on the tick that changed the state
+	Values map[string]float64 `json:"values"`
+	Since  time.Time          `json:"since"` // when the alert started firing
+	Time   time.Time          `json:"time"`
+	// stable per rule and host, so receivers can pair firing and resolved
+	Fingerprint string `json:"fingerprint"`
+}
+
+type alertKey struct {
+	rule int
+	host string
+}
+
+type alertState struct {
+	streak int // consecutive ticks the rule held
+	firing bool
+	since  time.Time
+}
+
+// Engine evaluates rules against successive snapshots. Summaries are
+// cumulative, so each host is judged on what it gained since the previous
+// snapshot. An Engine is not safe for concurrent use.
+type Engine struct {
+	rules  []Rule
+	last   map[string]accesslog.Row
+	states map[alertKey]*alertState
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{rules: rules, last: make(map[string]accesslog.Row), states: make(map[alertKey]*alertState)}
+}
+
+func (e *Engine) Evaluate(snap sink.Snapshot) []Event {
+	var events []Event
+	seen := make(map[string]bool, len(snap.Rows))
+
+	for _, row := range snap.Rows {
+		seen[row.Host] = true
+		tick := row
+		if prev, ok := e.last[row.Host]; ok && row.Requests >= prev.Requests {
+			tick = row.Sub(prev)
+		}
+		e.last[row.Host] = row
+
+		for i := range e.rules {
+			rule := &e.rules[i]
+			if !rule.Matches(row.Host) {
+				continue
+			}
+			key := alertKey{i, row.Host}
+			st := e.states[key]
+			if st == nil {
+				st = &alertState{}
+				e.states[key] = st
+			}
+
+			met, values := rule.holds(tick)
+			switch {
+			case met:
+				st.streak++
+				if !st.firing && st.streak >= rule.For {
+					st.firing, st.since = true, snap.Time
+					events = append(events, e.event(rule, row.Host, Firing, values, st.since, snap.Time))
+				}
+			case st.firing:
+				events = append(events, e.event(rule, row.Host, Resolved, values, st.since, snap.Time))
+				delete(e.states, key)
+			default:
+				st.streak = 0
+			}
+		}
+	}
+
+	// hosts evicted by -max-groups are gone, their alerts with them
+	for key, st := range e.states {
+		if seen[key.host] {
+			continue
+		}
+		if st.firing {
+			events = append(events, e.event(&e.rules[key.rule], key.host, Resolved, nil, st.since, snap.Time))
+		}
+		delete(e.states, key)
+		delete(e.last, key.host)
+	}
+	return events
+}
+
+func (e *Engine) event(rule *Rule, host string, state State, values map[string]float64, since, now time.Time) Event {
+	return Event{
+		Rule:        rule.Expr,
+		Host:        host,
+		State:       state,
+		Values:      values,
+		Since:       since,
+		Time:        now,
+		Fingerprint: fingerprint(rule.Expr, host),
+	}
+}
+
+// Notifier delivers the events of one tick.
+type Notifier interface {
+	Notify(events []Event) error
+}
+
+type NotifierFunc func(events []Event) error
+
+func (f NotifierFunc) Notify(events []Event) error { return f(events) }
+
+// events of this many ticks wait for delivery while notifiers are slow,
+// later ones are dropped and reported
+const deliveryQueue = 64
+
+// Sink runs an Engine on every snapshot it is given and delivers the events
+// on a goroutine of its own, so slow webhooks hold back neither the
+// evaluation nor aggregation. Write is meant to be called on every tick,
+// rules counting ticks are only right if no snapshot is skipped.
+type Sink struct {
+	engine    *Engine
+	notifiers []Notifier
+	report    func(err error)
+	queue     chan []Event
+	done      chan struct{}
+}
+
+// NewSink delivers events to every notifier in turn, report receives their
+// errors, nil ignores them.
+func NewSink(rules []Rule, report func(err error), notifiers ...Notifier) *Sink {
+	if report == nil {
+		report = func(error) {}
+	}
+	s := &Sink{engine: NewEngine(rules), notifiers: notifiers, report: report,
+		queue: make(chan []Event, deliveryQueue), done: make(chan struct{})}
+	go s.deliver()
+	return s
+}
+
+// Write evaluates snap and queues the events for delivery, without
+// waiting for them.
+func (s *Sink) Write(snap sink.Snapshot) error {
+	events := s.engine.Evaluate(snap)
+	if len(events) == 0 {
+		return nil
+	}
+	select {
+	case s.queue <- events:
+		return nil
+	default:
+		return fmt.Errorf("alert delivery is behind, dropped %d events of %s", len(events), snap.Time.Format(time.RFC3339))
+	}
+}
+
+func (s *Sink) deliver() {
+	defer close(s.done)
+	for events := range s.queue {
+		for _, n := range s.notifiers {
+			if err := n.Notify(events); err != nil {
+				s.report(err)
+			}
+		}
+	}
+}
+
+// Close waits for the queued events to be delivered.
+func (s *Sink) Close() error {
+	close(s.queue)
+	<-s.done
+	return nil
+}
@@ -0,0 +1,107 @@
+package alert
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/sink"
+	"errors"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+
+// ticks feeds cumulative snapshots where each tick adds the given 5xx
+// responses out of 10 requests for host
+func ticks(host string, errorsPerTick ...int) []sink.Snapshot {
+	var snaps []sink.Snapshot
+	var row accesslog.Row
+	row.Host = host
+	for i, n := range errorsPerTick {
+		row.Requests += 10
+		row.DurationTotal += 1
+		row.ByClass[2] += 10 - n
+		row.ByClass[5] += n
+		snaps = append(snaps, sink.Snapshot{Time: epoch.Add(time.Duration(i) * 10 * time.Second), Rows: []accesslog.Row{row}})
+	}
+	return snaps
+}
+
+func mustRule(t *testing.T, expr string) Rule {
+	t.Helper()
+	r, err := ParseRule(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestEngine_ForTicksAndResolve(t *testing.T) {
+	e := NewEngine([]Rule{mustRule(t, `host=~"api.*" and error_ratio > 0.05 for 3 ticks`)})
+
+	// 2 bad ticks, a good one resets the streak, then 4 bad ones and recovery
+	var got []Event
+	var at []int
+	for i, snap := range ticks("api.a.com", 1, 1, 0, 1, 1, 1, 1, 0, 0) {
+		for _, ev := range e.Evaluate(snap) {
+			got = append(got, ev)
+			at = append(at, i)
+		}
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want firing and resolved once: %+v", len(got), got)
+	}
+	if got[0].State != Firing || at[0] != 5 || got[0].Values["error_ratio"] != 0.1 {
+		t.Errorf("first event %+v at tick %d, want firing at tick 5", got[0], at[0])
+	}
+	if got[1].State != Resolved || at[1] != 7 || !got[1].Since.Equal(got[0].Time) {
+		t.Errorf("second event %+v at tick %d, want resolved at tick 7", got[1], at[1])
+	}
+	if got[0].Fingerprint != got[1].Fingerprint || got[0].Host != "api.a.com" {
+		t.Errorf("firing and resolved do not pair up: %+v", got)
+	}
+}
+
+func TestEngine_IgnoresOtherHosts(t *testing.T) {
+	e := NewEngine([]Rule{mustRule(t, `host="api.a.com" and error_ratio > 0.05`)})
+	for _, snap := range ticks("www.a.com", 5, 5) {
+		if ev := e.Evaluate(snap); len(ev) != 0 {
+			t.Fatalf("unexpected events %+v", ev)
+		}
+	}
+}
+
+func TestEngine_ResolvesEvictedHost(t *testing.T) {
+	e := NewEngine([]Rule{mustRule(t, `error_ratio > 0`)})
+	if ev := e.Evaluate(ticks("a.com", 1)[0]); len(ev) != 1 || ev[0].State != Firing {
+		t.Fatalf("events = %+v, want firing", ev)
+	}
+	ev := e.Evaluate(sink.Snapshot{Time: epoch.Add(time.Minute)})
+	if len(ev) != 1 || ev[0].State != Resolved || ev[0].Host != "a.com" {
+		t.Errorf("events = %+v, want resolved for the vanished host", ev)
+	}
+}
+
+func TestSink_NotifiesOnlyChanges(t *testing.T) {
+	var calls [][]Event
+	failing := NotifierFunc(func([]Event) error { return errors.New("down") })
+	var reported []error
+	s := NewSink([]Rule{mustRule(t, `error_ratio > 0`)}, func(err error) { reported = append(reported, err) },
+		NotifierFunc(func(ev []Event) error {
+			calls = append(calls, ev)
+			return nil
+		}), failing)
+
+	for i, snap := range ticks("a.com", 1, 1, 1, 0) {
+		if err := s.Write(snap); err != nil {
+			t.Errorf("Write() at tick %d error = %v", i, err)
+		}
+	}
+	s.Close()
+	if len(reported) != 2 {
+		t.Errorf("reported %v, want the failing notifier twice", reported)
+	}
+	if len(calls) != 2 || calls[0][0].State != Firing || calls[1][0].State != Resolved {
+		t.Errorf("notified %+v, want one firing and one resolved", calls)
+	}
+}
@@ -0,0 +1,291 @@
+package alert
+
+import (
+	"accessAggregator/internal/accesslog"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule is a parsed alert expression: conditions joined by "and", evaluated
+// per host on what the host did during one tick, and an optional number of
+// consecutive ticks they must hold before the alert fires.
+//
+//	host=~"api.*" and error_ratio > 0.05 for 3 ticks
+//
+// Hosts are matched with =, !=, =~ and !~ against a quoted string, metrics
+// with =, !=, <, <=, > and >= against a number. Strings in double quotes
+// take Go escapes, so a regular expression needs its backslashes doubled;
+// in backquotes they are taken verbatim, as in host=~`api\..*`. See
+// Metrics.
+type Rule struct {
+	Expr  string // the source text, identifies the rule in events
+	For   int    // consecutive ticks, at least 1
+	hosts []hostMatch
+	conds []condition
+}
+
+type hostMatch struct {
+	op    string
+	value string
+	re    *regexp.Regexp // for =~ and !~, anchored like PromQL
+}
+
+type condition struct {
+	metric string
+	op     string
+	value  float64
+}
+
+// Metrics are the names a rule can compare, computed from one tick.
+var Metrics = map[string]func(r accesslog.Row) float64{
+	"requests":     func(r accesslog.Row) float64 { return float64(r.Requests) },
+	"requests_2xx": func(r accesslog.Row) float64 { return float64(r.Requests2xx) },
+	// share of 5xx responses
+	"error_ratio": func(r accesslog.Row) float64 { return ratio(r.ByClass[5], r.Requests) },
+	// share of 4xx responses
+	"client_error_ratio": func(r accesslog.Row) float64 { return ratio(r.ByClass[4], r.Requests) },
+	// in seconds
+	"avg_duration": func(r accesslog.Row) float64 { return r.AvgDuration() },
+	// estimate since start, needs -distinct-field
+	"distinct": func(r accesslog.Row) float64 { return float64(r.Distinct) },
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func ParseRule(expr string) (Rule, error) {
+	toks, err := tokenize(expr)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid alert %q: %w", expr, err)
+	}
+	r := Rule{Expr: strings.TrimSpace(expr), For: 1}
+	if err := r.parse(toks); err != nil {
+		return Rule{}, fmt.Errorf("invalid alert %q: %w", expr, err)
+	}
+	return r, nil
+}
+
+func (r *Rule) parse(toks []token) error {
+	for i := 0; ; {
+		if i+2 >= len(toks) || toks[i].kind != tokIdent || toks[i+1].kind != tokOp {
+			return fmt.Errorf("want <host|metric> <op> <value> at %q", rest(toks, i))
+		}
+		name, op, val := toks[i].text, toks[i+1].text, toks[i+2]
+		i += 3
+
+		if name == "host" {
+			m, err := newHostMatch(op, val)
+			if err != nil {
+				return err
+			}
+			r.hosts = append(r.hosts, m)
+		} else {
+			if _, ok := Metrics[name]; !ok {
+				return fmt.Errorf("unknown metric %q", name)
+			}
+			if val.kind != tokNumber || op == "=~" || op == "!~" {
+				return fmt.Errorf("metric %s needs a comparison with a number", name)
+			}
+			v, err := strconv.ParseFloat(val.text, 64)
+			if err != nil {
+				return err
+			}
+			r.conds = append(r.conds, condition{metric: name, op: op, value: v})
+		}
+
+		switch {
+		case i == len(toks):
+			return r.check()
+		case toks[i].is("and"):
+			i++
+		case toks[i].is("for"):
+			if i+3 != len(toks) || toks[i+1].kind != tokNumber || !(toks[i+2].is("tick") || toks[i+2].is("ticks")) {
+				return fmt.Errorf("want for <n> ticks at the end, got %q", rest(toks, i))
+			}
+			n, err := strconv.Atoi(toks[i+1].text)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid tick count %q", toks[i+1].text)
+			}
+			r.For = n
+			return r.check()
+		default:
+			return fmt.Errorf("want and or for, got %q", toks[i].text)
+		}
+	}
+}
+
+func (r *Rule) check() error {
+	if len(r.conds) == 0 {
+		return fmt.Errorf("no metric condition")
+	}
+	return nil
+}
+
+func newHostMatch(op string, val token) (hostMatch, error) {
+	if val.kind != tokString {
+		return hostMatch{}, fmt.Errorf("host needs a quoted string")
+	}
+	m := hostMatch{op: op, value: val.text}
+	switch op {
+	case "=", "==", "!=":
+	case "=~", "!~":
+		re, err := regexp.Compile("^(?:" + val.text + ")$")
+		if err != nil {
+			return hostMatch{}, err
+		}
+		m.re = re
+	default:
+		return hostMatch{}, fmt.Errorf("host cannot be compared with %s", op)
+	}
+	return m, nil
+}
+
+// Matches reports whether the host selectors of the rule accept host.
+func (r *Rule) Matches(host string) bool {
+	for _, m := range r.hosts {
+		var ok bool
+		switch m.op {
+		case "=", "==":
+			ok = host == m.value
+		case "!=":
+			ok = host != m.value
+		case "=~":
+			ok = m.re.MatchString(host)
+		case "!~":
+			ok = !m.re.MatchString(host)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// holds reports whether every condition is met by one tick of a host, and
+// the metric values it looked at.
+func (r *Rule) holds(row accesslog.Row) (bool, map[string]float64) {
+	values := make(map[string]float64, len(r.conds))
+	met := true
+	for _, c := range r.conds {
+		v := Metrics[c.metric](row)
+		values[c.metric] = v
+		if !compare(v, c.op, c.value) {
+			met = false
+		}
+	}
+	return met, values
+}
+
+func compare(a float64, op string, b float64) bool {
+	switch op {
+	case "=", "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) is(word string) bool { return t.kind == tokIdent && t.text == word }
+
+func rest(toks []token, i int) string {
+	var parts []string
+	for _, t := range toks[min(i, len(toks)):] {
+		parts = append(parts, t.text)
+	}
+	return strings.Join(parts, " ")
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string %s", s[i:j+1])
+			}
+			toks = append(toks, token{tokString, v})
+			i = j + 1
+		case c == '`':
+			j := strings.IndexByte(s[i+1:], '`')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			toks = append(toks, token{tokString, s[i+1 : i+1+j]})
+			i += j + 2
+		case c >= '0' && c <= '9' || c == '.' ||
+			c == '-' && i+1 < len(s) && (s[i+1] >= '0' && s[i+1] <= '9' || s[i+1] == '.'):
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				(s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E')) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j]})
+			i = j
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_':
+			j := i
+			for j < len(s) && (s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z' || s[j] >= '0' && s[j] <= '9' || s[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j]})
+			i = j
+		case strings.ContainsRune("=!<>~", rune(c)):
+			j := i
+			for j < len(s) && strings.ContainsRune("=!<>~", rune(s[j])) {
+				j++
+			}
+			switch op := s[i:j]; op {
+			case "=", "==", "!=", "=~", "!~", "<", "<=", ">", ">=":
+				toks = append(toks, token{tokOp, op})
+			default:
+				return nil, fmt.Errorf("unknown operator %q", op)
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+	}
+	return toks, nil
+}
@@ -0,0 +1,116 @@
+package alert
+
+import (
+	"accessAggregator/internal/accesslog"
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		wantFor   int
+		match     []string
+		noMatch   []string
+		wantError string
+	}{
+		{
+			name:    "host regex, ratio and ticks",
+			expr:    `host=~"api.*" and error_ratio > 0.05 for 3 ticks`,
+			wantFor: 3,
+			match:   []string{"api.a.com", "api"},
+			noMatch: []string{"www.api.com"},
+		},
+		{
+			name:    "no host selector matches every host",
+			expr:    `avg_duration >= 1.5`,
+			wantFor: 1,
+			match:   []string{"a.com", "b.com"},
+		},
+		{
+			name:    "several selectors",
+			expr:    `host !~ "internal\\..*" and host != "b.com" and requests > 1e3 and error_ratio>0 for 1 tick`,
+			wantFor: 1,
+			match:   []string{"a.com"},
+			noMatch: []string{"internal.a.com", "b.com"},
+		},
+		{
+			name:    "backquoted regex taken verbatim",
+			expr:    "host=~`api\\..*` and requests > -1e3",
+			wantFor: 1,
+			match:   []string{"api.a.com"},
+			noMatch: []string{"apixa.com"},
+		},
+		{name: "unknown metric", expr: `latency > 1`, wantError: "unknown metric"},
+		{name: "host only", expr: `host="a.com"`, wantError: "no metric condition"},
+		{name: "host compared to number", expr: `host=1 and requests>1`, wantError: "quoted string"},
+		{name: "metric regex", expr: `requests=~"1"`, wantError: "number"},
+		{name: "bad regex", expr: `host=~"(" and requests>1`, wantError: "missing closing"},
+		{name: "zero ticks", expr: `requests>1 for 0 ticks`, wantError: "tick count"},
+		{name: "for not last", expr: `requests>1 for 2 ticks and error_ratio>0`, wantError: "at the end"},
+		{name: "missing value", expr: `requests >`, wantError: "want <host|metric>"},
+		{name: "or is not supported", expr: `requests>1 or error_ratio>0`, wantError: "want and or for"},
+		{name: "unknown operator", expr: `requests => 1`, wantError: "unknown operator"},
+		{name: "unterminated string", expr: `host="a.com and requests>1`, wantError: "unterminated"},
+		{name: "unterminated raw string", expr: "host=`a.com and requests>1", wantError: "unterminated"},
+		{name: "lone minus", expr: `requests > -`, wantError: "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRule(tt.expr)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("ParseRule() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRule() error = %v", err)
+			}
+			if r.For != tt.wantFor {
+				t.Errorf("For = %d, want %d", r.For, tt.wantFor)
+			}
+			for _, h := range tt.match {
+				if !r.Matches(h) {
+					t.Errorf("rule does not match host %q", h)
+				}
+			}
+			for _, h := range tt.noMatch {
+				if r.Matches(h) {
+					t.Errorf("rule matches host %q", h)
+				}
+			}
+		})
+	}
+}
+
+func TestRule_Holds(t *testing.T) {
+	r, err := ParseRule(`error_ratio > 0.05 and avg_duration <= 0.5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := accesslog.Row{Requests: 10, DurationTotal: 2, ByClass: [6]int{2: 9, 5: 1}}
+	met, values := r.holds(row)
+	if !met || values["error_ratio"] != 0.1 || values["avg_duration"] != 0.2 {
+		t.Errorf("holds() = %v, %v", met, values)
+	}
+
+	row.DurationTotal = 6
+	if met, _ := r.holds(row); met {
+		t.Error("holds() with avg_duration 0.6")
+	}
+	if met, _ := r.holds(accesslog.Row{}); met {
+		t.Error("holds() on a host without requests")
+	}
+
+	r, err = ParseRule(`requests > -1 and avg_duration >= -.5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if met, _ := r.holds(row); !met {
+		t.Error("holds() = false against negative bounds")
+	}
+}
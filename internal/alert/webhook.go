@@ -0,0 +1,92 @@
+package alert
+
+import (
+	"accessAggregator/internal/clock"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type WebhookOptions struct {
+	Retries int           // attempts after the first, defaults to 3, negative for none
+	Backoff time.Duration // before the first retry, doubled each time, defaults to 1s
+	Timeout time.Duration // per attempt, defaults to 10s
+	Clock   clock.Clock   // defaults to clock.Real
+}
+
+// Webhook POSTs the events of a tick as {"alerts": [...]} to a URL.
+// Network errors, 429 and 5xx answers are retried with exponential backoff,
+// other answers are final.
+type Webhook struct {
+	url    string
+	opts   WebhookOptions
+	client *http.Client
+}
+
+func NewWebhook(url string, opts WebhookOptions) *Webhook {
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real{}
+	}
+	return &Webhook{url: url, opts: opts, client: &http.Client{Timeout: opts.Timeout}}
+}
+
+func (w *Webhook) Notify(events []Event) error {
+	body, err := json.Marshal(struct {
+		Alerts []Event `json:"alerts"`
+	}{events})
+	if err != nil {
+		return err
+	}
+
+	backoff := w.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == max(w.opts.Retries, 0) {
+			return fmt.Errorf("alert webhook: %w after %d attempts", err, attempt+1)
+		}
+		<-w.opts.Clock.After(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) post(body []byte) (retry bool, err error) {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("%s", resp.Status)
+	}
+	return false, fmt.Errorf("%s", resp.Status)
+}
+
+func fingerprint(rule, host string) string {
+	h := fnv.New64a()
+	h.Write([]byte(rule))
+	h.Write([]byte{0})
+	h.Write([]byte(host))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
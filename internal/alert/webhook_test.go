@@ -0,0 +1,115 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhook_RetriesServerErrors(t *testing.T) {
+	var attempts atomic.Int32
+	var got struct{ Alerts []Event }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	w := NewWebhook(srv.URL, WebhookOptions{Backoff: time.Millisecond})
+	ev := Event{Rule: "error_ratio > 0", Host: "a.com", State: Firing, Values: map[string]float64{"error_ratio": 0.5}, Time: epoch}
+	if err := w.Notify([]Event{ev}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("attempts = %d, want 3", attempts.Load())
+	}
+	if len(got.Alerts) != 1 || got.Alerts[0].Host != "a.com" || got.Alerts[0].State != Firing || got.Alerts[0].Values["error_ratio"] != 0.5 {
+		t.Errorf("received %+v", got)
+	}
+}
+
+func TestWebhook_GivesUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int32
+	}{
+		{name: "client error is final", status: http.StatusBadRequest, wantAttempts: 1},
+		{name: "server error after retries", status: http.StatusInternalServerError, wantAttempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			w := NewWebhook(srv.URL, WebhookOptions{Retries: 2, Backoff: time.Millisecond})
+			err := w.Notify([]Event{{Host: "a.com"}})
+			if err == nil || !strings.Contains(err.Error(), http.StatusText(tt.status)) {
+				t.Errorf("Notify() error = %v", err)
+			}
+			if attempts.Load() != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestSink_SlowWebhook(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var body struct{ Alerts []Event }
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		got = append(got, body.Alerts...)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	s := NewSink([]Rule{mustRule(t, `error_ratio > 0 for 2 ticks`)}, nil, NewWebhook(srv.URL, WebhookOptions{}))
+	// every tick is evaluated while the webhook hangs
+	start := time.Now()
+	for i, snap := range ticks("a.com", 1, 1, 1, 0, 1, 1) {
+		if err := s.Write(snap); err != nil {
+			t.Errorf("Write() at tick %d error = %v", i, err)
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Write() waited %v on the webhook", d)
+	}
+	close(release)
+	s.Close()
+
+	want := []struct {
+		state State
+		since time.Time
+	}{{Firing, epoch.Add(10 * time.Second)}, {Resolved, epoch.Add(10 * time.Second)}, {Firing, epoch.Add(50 * time.Second)}}
+	if len(got) != len(want) {
+		t.Fatalf("delivered %+v, want %d events", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].State != w.state || !got[i].Since.Equal(w.since) {
+			t.Errorf("event %d = %s since %v, want %s since %v", i, got[i].State, got[i].Since, w.state, w.since)
+		}
+	}
+}
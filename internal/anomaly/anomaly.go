@@ -0,0 +1,154 @@
+package anomaly
+
+import (
+	"accessAggregator/internal/accesslog"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ticks a baseline learns from before it can flag anything
+const warmup = 5
+
+type Options struct {
+	Sigma float64 // deviations flagged, in standard deviations, e.g. 3
+	Alpha float64 // EWMA weight of the newest tick, defaults to 0.3
+}
+
+// Event is one metric of one host that left its baseline on a tick.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	Metric string    `json:"metric"`
+	Value  float64   `json:"value"`
+	Mean   float64   `json:"mean"`
+	StdDev float64   `json:"stddev"`
+	Score  float64   `json:"score"` // signed distance from Mean in StdDev
+}
+
+// metrics a baseline is kept for, computed from what a host did in a tick
+var metrics = []struct {
+	name string
+	// ok is false when the tick says nothing about the metric
+	value func(tick accesslog.Row, interval time.Duration) (v float64, ok bool)
+}{
+	{"rate", func(r accesslog.Row, iv time.Duration) (float64, bool) {
+		return float64(r.Requests) / iv.Seconds(), true
+	}},
+	{"error_ratio", func(r accesslog.Row, _ time.Duration) (float64, bool) {
+		return float64(r.ByClass[5]) / float64(r.Requests), r.Requests > 0
+	}},
+	{"avg_duration", func(r accesslog.Row, _ time.Duration) (float64, bool) {
+		return r.AvgDuration(), r.Requests > 0
+	}},
+}
+
+// baseline is an exponentially weighted mean and variance
+type baseline struct {
+	mean, variance float64
+	n              int
+}
+
+func (b *baseline) update(x, alpha float64) {
+	if b.n == 0 {
+		b.mean = x
+	} else {
+		diff := x - b.mean
+		incr := alpha * diff
+		b.mean += incr
+		b.variance = (1 - alpha) * (b.variance + diff*incr)
+	}
+	b.n++
+}
+
+// stdDev has a floor of a tenth of the mean, so a metric that was flat
+// during warmup is not flagged for any small wobble afterwards
+func (b *baseline) stdDev() float64 {
+	return max(math.Sqrt(b.variance), math.Abs(b.mean)/10)
+}
+
+// Detector keeps per host baselines of request rate, error ratio and mean
+// duration, fed with what each host gained since the previous snapshot.
+// A Detector is not safe for concurrent use.
+type Detector struct {
+	opts      Options
+	last      map[string]accesslog.Row
+	lastTime  time.Time
+	baselines map[string]*[3]baseline
+}
+
+func New(opts Options) *Detector {
+	if opts.Alpha <= 0 || opts.Alpha > 1 {
+		opts.Alpha = 0.3
+	}
+	return &Detector{opts: opts, last: make(map[string]accesslog.Row), baselines: make(map[string]*[3]baseline)}
+}
+
+// Observe feeds the cumulative rows of the tick at t and returns the
+// metrics found out of line, sorted by host.
+func (d *Detector) Observe(t time.Time, rows []accesslog.Row) []Event {
+	interval := t.Sub(d.lastTime)
+	first := d.lastTime.IsZero()
+	d.lastTime = t
+
+	var events []Event
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		seen[row.Host] = true
+		prev, known := d.last[row.Host]
+		d.last[row.Host] = row
+		// the first tick covers an unknown span, only start counting
+		if first || interval <= 0 {
+			continue
+		}
+		tick := row
+		if known && row.Requests >= prev.Requests {
+			tick = row.Sub(prev)
+		}
+
+		b := d.baselines[row.Host]
+		if b == nil {
+			b = new([3]baseline)
+			d.baselines[row.Host] = b
+		}
+		for i, m := range metrics {
+			x, ok := m.value(tick, interval)
+			if !ok {
+				continue
+			}
+			if b[i].n >= warmup {
+				if sd := b[i].stdDev(); sd > 0 {
+					if score := (x - b[i].mean) / sd; math.Abs(score) >= d.opts.Sigma {
+						events = append(events, Event{Time: t, Host: row.Host, Metric: m.name, Value: x, Mean: b[i].mean, StdDev: sd, Score: score})
+					}
+				}
+			}
+			b[i].update(x, d.opts.Alpha)
+		}
+	}
+
+	// hosts evicted by -max-groups start over if they come back
+	for host := range d.last {
+		if !seen[host] {
+			delete(d.last, host)
+			delete(d.baselines, host)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Host < events[j].Host })
+	return events
+}
+
+// Marks renders events as one note per host for the table.
+func Marks(events []Event) map[string]string {
+	marks := make(map[string]string)
+	for _, ev := range events {
+		note := fmt.Sprintf("%s %+.1fσ", ev.Metric, ev.Score)
+		if m := marks[ev.Host]; m != "" {
+			note = m + ", " + note
+		}
+		marks[ev.Host] = note
+	}
+	return marks
+}
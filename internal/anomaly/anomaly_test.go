@@ -0,0 +1,104 @@
+package anomaly
+
+import (
+	"accessAggregator/internal/accesslog"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+
+// feed adds per tick requests, 5xx and total duration to a cumulative row
+// and observes it every 10s, returning the events of each tick
+func feed(d *Detector, ticks [][3]float64) [][]Event {
+	var row accesslog.Row
+	row.Host = "a.com"
+	var out [][]Event
+	for i, tk := range ticks {
+		row.Requests += int(tk[0])
+		row.ByClass[5] += int(tk[1])
+		row.ByClass[2] += int(tk[0] - tk[1])
+		row.DurationTotal += tk[2]
+		out = append(out, d.Observe(epoch.Add(time.Duration(i)*10*time.Second), []accesslog.Row{row}))
+	}
+	return out
+}
+
+func steady(n int) [][3]float64 {
+	var ticks [][3]float64
+	for i := range n {
+		// a little noise so the baseline has some spread
+		ticks = append(ticks, [3]float64{100 + float64(i%3), 1, 10 + float64(i%2)})
+	}
+	return ticks
+}
+
+func TestDetector_FlagsSpikes(t *testing.T) {
+	tests := []struct {
+		name       string
+		spike      [3]float64
+		wantMetric string
+		wantSign   float64
+	}{
+		{name: "rate spike", spike: [3]float64{500, 5, 50}, wantMetric: "rate", wantSign: 1},
+		{name: "rate drop", spike: [3]float64{10, 0, 1}, wantMetric: "rate", wantSign: -1},
+		{name: "errors", spike: [3]float64{100, 40, 10}, wantMetric: "error_ratio", wantSign: 1},
+		{name: "slow", spike: [3]float64{100, 1, 80}, wantMetric: "avg_duration", wantSign: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(Options{Sigma: 3})
+			got := feed(d, append(steady(12), tt.spike))
+
+			for i, evs := range got[:12] {
+				if len(evs) != 0 {
+					t.Fatalf("steady tick %d flagged %+v", i, evs)
+				}
+			}
+			found := false
+			for _, ev := range got[12] {
+				if ev.Metric == tt.wantMetric && ev.Score*tt.wantSign >= 3 && ev.Host == "a.com" {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("spike events = %+v, want a %s event", got[12], tt.wantMetric)
+			}
+		})
+	}
+}
+
+func TestDetector_Warmup(t *testing.T) {
+	d := New(Options{Sigma: 3})
+	// the first tick only starts counting, then warmup ticks build the baseline
+	ticks := append(steady(warmup), [3]float64{1000, 500, 900})
+	for i, evs := range feed(d, ticks) {
+		if len(evs) != 0 {
+			t.Errorf("tick %d flagged %+v during warmup", i, evs)
+		}
+	}
+}
+
+func TestDetector_ForgetsVanishedHosts(t *testing.T) {
+	d := New(Options{Sigma: 3})
+	feed(d, steady(10))
+	d.Observe(epoch.Add(time.Hour), nil)
+	if len(d.baselines) != 0 || len(d.last) != 0 {
+		t.Errorf("detector kept state of a vanished host: %v", d.baselines)
+	}
+}
+
+func TestMarks(t *testing.T) {
+	marks := Marks([]Event{
+		{Host: "a.com", Metric: "rate", Score: 4.26},
+		{Host: "a.com", Metric: "avg_duration", Score: -3.01},
+		{Host: "b.com", Metric: "error_ratio", Score: 5},
+	})
+	want := map[string]string{"a.com": "rate +4.3σ, avg_duration -3.0σ", "b.com": "error_ratio +5.0σ"}
+	for h, m := range want {
+		if marks[h] != m {
+			t.Errorf("Marks()[%s] = %q, want %q", h, marks[h], m)
+		}
+	}
+}
@@ -2,43 +2,131 @@ package app
 
 import (
 	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/anomaly"
+	"accessAggregator/internal/clock"
 	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
 	"fmt"
 	"io"
 	"time"
 )
 
-func aggr(aggrDone chan<- struct{}, flags config.Flags, data <-chan []byte, summaries accesslog.Summarizer, out io.Writer) {
-	ticker := time.NewTicker(flags.Interval)
+// summarizers that parse off the caller goroutine cannot return parse
+// errors from Aggregate, so they count them instead
+type malformedCounter interface {
+	Malformed() int
+}
+
+type overflowCounter interface {
+	Overflow() int
+}
+
+type sloReporter interface {
+	SLOs() []accesslog.SLOStatus
+}
+
+func snapshot(asOf time.Time, final bool, summaries accesslog.Summarizer, malformed int, inputs []*inputStats) sink.Snapshot {
+	snap := sink.Snapshot{Time: asOf, Final: final, Malformed: malformed}
+	if s, ok := summaries.(accesslog.Snapshotter); ok {
+		snap.Rows = s.Rows()
+	}
+	if o, ok := summaries.(overflowCounter); ok {
+		snap.Overflow = o.Overflow()
+	}
+	if r, ok := summaries.(sloReporter); ok {
+		snap.SLOs = r.SLOs()
+	}
+	for _, in := range inputs {
+		snap.Inputs = append(snap.Inputs, sink.InputStats{
+			Name:     in.name,
+			State:    in.getState().String(),
+			Blocked:  time.Duration(in.blocked.Load()),
+			Dropped:  in.dropped.Load(),
+			Oversize: in.oversize.Load(),
+
+			Throttled:  time.Duration(in.throttled.Load()),
+			Throttling: in.throttling.Load(),
+		})
+	}
+	return snap
+}
+
+// aggr reports its progress to rp when set, see replay.
+func aggr(aggrDone chan<- struct{}, flags config.Flags, clk clock.Clock, data <-chan []byte, summaries accesslog.Summarizer, inputs []*inputStats, onTick TickFunc, out io.Writer, rp *replay) {
+	ticker := clk.NewTicker(flags.Interval)
 	defer ticker.Stop()
+	rp.started()
+
+	pal := newPalette(flags.Color, out)
+
+	var detector *anomaly.Detector
+	if flags.AnomalySigma > 0 {
+		detector = anomaly.New(anomaly.Options{Sigma: flags.AnomalySigma, Alpha: flags.AnomalyAlpha})
+	}
 
 	var malformRecord int
-	printSummaries := func() {
-		fmt.Fprint(out, summaries.Format())
+	printSummaries := func(asOf time.Time, final bool) {
+		if mc, ok := summaries.(malformedCounter); ok {
+			malformRecord = mc.Malformed()
+		}
+
+		var snap sink.Snapshot
+		if onTick != nil || detector != nil {
+			snap = snapshot(asOf, final, summaries, malformRecord, inputs)
+		}
+		marker, canMark := summaries.(accesslog.Marker)
+		if detector != nil {
+			snap.Anomalies = detector.Observe(asOf, snap.Rows)
+		}
+		if detector != nil && canMark {
+			fmt.Fprint(out, marker.FormatMarked(asOf, anomaly.Marks(snap.Anomalies)))
+		} else {
+			fmt.Fprint(out, summaries.Format(asOf))
+		}
+
 		if malformRecord > 0 {
-			fmt.Fprintln(out, yellow+"missing field or malformed log:", malformRecord, reset)
+			fmt.Fprintln(out, pal.paint(yellow, fmt.Sprint("missing field or malformed log: ", malformRecord)))
+		}
+		for _, in := range inputs {
+			blocked := time.Duration(in.blocked.Load())
+			dropped := in.dropped.Load()
+			if blocked > 0 || dropped > 0 {
+				fmt.Fprintln(out, pal.paint(yellow, fmt.Sprintf("[%s] backpressure blocked: %v, dropped: %d",
+					in.name, blocked.Round(time.Millisecond), dropped)))
+			}
+			if throttled := time.Duration(in.throttled.Load()); throttled > 0 {
+				fmt.Fprintln(out, pal.paint(yellow, fmt.Sprintf("[%s] rate limited: %v, throttling: %t",
+					in.name, throttled.Round(time.Millisecond), in.throttling.Load())))
+			}
+			if oversize := in.oversize.Load(); oversize > 0 {
+				fmt.Fprintln(out, pal.paint(yellow, fmt.Sprintf("[%s] oversize lines skipped: %d", in.name, oversize)))
+			}
+		}
+		if onTick != nil {
+			onTick(snap, summaries)
 		}
 	}
 
 	for {
 		select {
-		case <-ticker.C:
-			printSummaries()
+		case t := <-ticker.C():
+			printSummaries(t, false)
+			rp.progressed(true)
 
 		// keep process data even after context canceled
 		// to drain remaining data, then give signal
 		// when channel already empty
 		case r, ok := <-data:
 			if !ok {
-				fmt.Fprint(out, green+"\nPrinting final summary:"+reset)
-				printSummaries()
+				fmt.Fprint(out, pal.paint(green, "\nPrinting final summary:"))
+				printSummaries(clk.Now(), true)
 				close(aggrDone)
 				return
 			}
 			if err := summaries.Aggregate(r); err != nil {
 				malformRecord++
-				continue
 			}
+			rp.progressed(false)
 		}
 	}
 }
@@ -1,11 +1,16 @@
 package app
 
 import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/clock"
 	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
 	"bytes"
 	"errors"
 	"io"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -21,7 +26,7 @@ func (m *mockSummarizer) Aggregate(b []byte) error {
 	return m.aggregateErr
 }
 
-func (m *mockSummarizer) Format() string {
+func (m *mockSummarizer) Format(asOf time.Time) string {
 	return m.formatOut
 }
 
@@ -36,20 +41,53 @@ func waitOrTimeout(t *testing.T, ch <-chan struct{}, timeout time.Duration) {
 }
 
 
+// syncBuffer lets a test read output while aggr is still writing it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *syncBuffer) waitFor(t *testing.T, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(b.String(), substr) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %q in output: %s", substr, b.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var epoch = time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+
 func TestAggr_TickerPrintsSummary(t *testing.T) {
-	out := &bytes.Buffer{}
+	out := &syncBuffer{}
 	s := &mockSummarizer{formatOut: "SUMMARY\n"}
 
 	data := make(chan []byte)
 	done := make(chan struct{})
 
-	// fast ticker
-	flags := config.Flags{Interval: 15 * time.Millisecond}
+	flags := config.Flags{Interval: 10 * time.Second}
+	clk := clock.NewFake(epoch)
 
-	go aggr(done, flags, data, s, out)
+	go aggr(done, flags, clk, data, s, nil, nil, out, nil)
 
 	// ticker fire once
-	time.Sleep(20 * time.Millisecond)
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Second)
+	out.waitFor(t, "SUMMARY")
 
 	close(data) // trigger exit
 	waitOrTimeout(t, done, time.Second)
@@ -67,7 +105,7 @@ func TestAggr_AggregatesData(t *testing.T) {
 
 	flags := config.Flags{Interval: time.Hour} // disable ticker firing
 
-	go aggr(done, flags, data, s, io.Discard)
+	go aggr(done, flags, clock.Real{}, data, s, nil, nil, io.Discard, nil)
 
 	data <- []byte("A")
 	data <- []byte("B")
@@ -81,7 +119,7 @@ func TestAggr_AggregatesData(t *testing.T) {
 }
 
 func TestAggr_MalformedIncrementPrinted(t *testing.T) {
-	out := &bytes.Buffer{}
+	out := &syncBuffer{}
 	s := &mockSummarizer{
 		formatOut:    "SUMMARY\n",
 		aggregateErr: errors.New("bad"),
@@ -90,14 +128,17 @@ func TestAggr_MalformedIncrementPrinted(t *testing.T) {
 	data := make(chan []byte, 1)
 	done := make(chan struct{})
 
-	flags := config.Flags{Interval: 15 * time.Millisecond}
+	flags := config.Flags{Interval: 10 * time.Second}
+	clk := clock.NewFake(epoch)
 
-	go aggr(done, flags, data, s, out)
+	go aggr(done, flags, clk, data, s, nil, nil, out, nil)
 
 	// send malformed record
 	data <- []byte("BAD")
 	// wait for ticker to print summary
-	time.Sleep(20 * time.Millisecond)
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Second)
+	out.waitFor(t, "missing field or malformed log:")
 
 	close(data)
 	waitOrTimeout(t, done, time.Second)
@@ -116,7 +157,7 @@ func TestAggr_FinalSummaryAndDoneClose(t *testing.T) {
 
 	flags := config.Flags{Interval: time.Hour}
 
-	go aggr(done, flags, data, s, out)
+	go aggr(done, flags, clock.Real{}, data, s, nil, nil, out, nil)
 
 	close(data) // trigger final summary + done close
 
@@ -138,7 +179,7 @@ func TestAggr_DrainsAllRecordsBeforeEnd(t *testing.T) {
 
 	flags := config.Flags{Interval: time.Hour}
 
-	go aggr(done, flags, data, s, io.Discard)
+	go aggr(done, flags, clock.Real{}, data, s, nil, nil, io.Discard, nil)
 
 	data <- []byte("1")
 	data <- []byte("2")
@@ -160,10 +201,189 @@ func TestAggr_NoGoroutineLeak(t *testing.T) {
 
 	flags := config.Flags{Interval: 10 * time.Millisecond}
 
-	go aggr(done, flags, data, s, io.Discard)
+	go aggr(done, flags, clock.Real{}, data, s, nil, nil, io.Discard, nil)
 
 	close(data)
 
 	waitOrTimeout(t, done, time.Second)
 	// no hang mean success
 }
+
+type mockAsyncSummarizer struct {
+	mockSummarizer
+	malformed int
+}
+
+func (m *mockAsyncSummarizer) Malformed() int {
+	return m.malformed
+}
+
+func TestAggr_MalformedFromAsyncSummarizer(t *testing.T) {
+	out := &bytes.Buffer{}
+	s := &mockAsyncSummarizer{mockSummarizer: mockSummarizer{formatOut: "SUMMARY\n"}, malformed: 3}
+
+	data := make(chan []byte)
+	done := make(chan struct{})
+
+	flags := config.Flags{Interval: time.Hour}
+
+	go aggr(done, flags, clock.Real{}, data, s, nil, nil, out, nil)
+
+	close(data)
+	waitOrTimeout(t, done, time.Second)
+
+	if !strings.Contains(out.String(), "missing field or malformed log: 3") {
+		t.Fatalf("expected malformed count from summarizer, got: %s", out.String())
+	}
+}
+
+func TestAggr_ExactTickOutput(t *testing.T) {
+	out := &syncBuffer{}
+	summaries := accesslog.NewSummaries()
+
+	data := make(chan []byte)
+	done := make(chan struct{})
+
+	flags := config.Flags{Interval: 10 * time.Second, Color: config.ColorAlways}
+	clk := clock.NewFake(epoch)
+
+	go aggr(done, flags, clk, data, summaries, nil, nil, out, nil)
+	clk.BlockUntil(1)
+
+	// unbuffered sends return once aggr picked the record up, and aggr
+	// aggregates it before selecting again
+	data <- []byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.5}`)
+	data <- []byte(`{"time":"2025-08-14T02:07:13Z","host":"a.com","status_code":503,"duration":1.5}`)
+	data <- []byte(`not json`)
+
+	clk.Advance(10 * time.Second)
+	out.waitFor(t, "02:07:10")
+	clk.Advance(10 * time.Second)
+	out.waitFor(t, "02:07:20")
+
+	close(data)
+	waitOrTimeout(t, done, time.Second)
+
+	want := summaries.Format(epoch.Add(10*time.Second)) + yellow + "missing field or malformed log: 1" + reset + "\n" +
+		summaries.Format(epoch.Add(20*time.Second)) + yellow + "missing field or malformed log: 1" + reset + "\n" +
+		green + "\nPrinting final summary:" + reset +
+		summaries.Format(epoch.Add(20*time.Second)) + yellow + "missing field or malformed log: 1" + reset + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("output mismatch\ngot:\n%q\nwant:\n%q", got, want)
+	}
+	for _, line := range []string{
+		"*** Access Log Summary as of 2025-08-14 02:07:10 ***",
+		"*** Access Log Summary as of 2025-08-14 02:07:20 ***",
+		"a.com                 2               1                  1              1.000",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in output, got: %s", line, out.String())
+		}
+	}
+}
+
+func TestAggr_OnTick(t *testing.T) {
+	s := &mockSummarizer{formatOut: "SUMMARY\n"}
+
+	type call struct {
+		asOf  time.Time
+		final bool
+	}
+	var calls []call
+	onTick := func(snap sink.Snapshot, summaries accesslog.Summarizer) {
+		if summaries != s {
+			t.Errorf("onTick got summarizer %v, want the aggregated one", summaries)
+		}
+		calls = append(calls, call{snap.Time, snap.Final})
+	}
+
+	data := make(chan []byte)
+	done := make(chan struct{})
+	clk := clock.NewFake(epoch)
+	out := &syncBuffer{}
+
+	go aggr(done, config.Flags{Interval: 10 * time.Second}, clk, data, s, nil, onTick, out, nil)
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Second)
+	out.waitFor(t, "SUMMARY")
+	clk.Advance(5 * time.Second)
+
+	close(data)
+	waitOrTimeout(t, done, time.Second)
+
+	want := []call{{epoch.Add(10 * time.Second), false}, {epoch.Add(15 * time.Second), true}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("onTick calls = %v, want %v", calls, want)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	summaries := accesslog.NewSummaries()
+	summaries.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"b.com","status_code":200,"duration":0.5}`))
+	summaries.Aggregate([]byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":500,"duration":0.25}`))
+
+	in := &inputStats{name: "access.log"}
+	in.dropped.Store(2)
+
+	got := snapshot(epoch, true, summaries, 3, []*inputStats{in})
+	want := sink.Snapshot{
+		Time:  epoch,
+		Final: true,
+		Rows: []accesslog.Row{
+			{Host: "a.com", Requests: 1, Requests2xx: 0, DurationTotal: 0.25, ByClass: [6]int{5: 1}},
+			{Host: "b.com", Requests: 1, Requests2xx: 1, DurationTotal: 0.5, ByClass: [6]int{2: 1}},
+		},
+		Malformed: 3,
+		Inputs:    []sink.InputStats{{Name: "access.log", State: "opening", Dropped: 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("snapshot() = %+v\nwant %+v", got, want)
+	}
+
+	// summarizers without rows still produce the counters
+	if got := snapshot(epoch, false, &mockSummarizer{}, 1, nil); got.Rows != nil || got.Malformed != 1 {
+		t.Errorf("snapshot() of plain summarizer = %+v", got)
+	}
+}
+
+func TestAggr_MarksAnomalies(t *testing.T) {
+	out := &syncBuffer{}
+	summaries, _ := accesslog.NewAggregator(accesslog.Options{})
+
+	data := make(chan []byte)
+	done := make(chan struct{})
+	var snaps []sink.Snapshot
+	onTick := func(snap sink.Snapshot, _ accesslog.Summarizer) { snaps = append(snaps, snap) }
+
+	flags := config.Flags{Interval: 10 * time.Second, AnomalySigma: 3, AnomalyAlpha: 0.3}
+	clk := clock.NewFake(epoch)
+	go aggr(done, flags, clk, data, summaries, nil, onTick, out, nil)
+	clk.BlockUntil(1)
+
+	record := []byte(`{"time":"2025-08-14T02:07:12Z","host":"a.com","status_code":200,"duration":0.1}`)
+	// a steady 10 requests per tick, then 100
+	for tick := range 10 {
+		n := 10
+		if tick == 9 {
+			n = 100
+		}
+		for range n {
+			data <- record
+		}
+		clk.Advance(10 * time.Second)
+		out.waitFor(t, epoch.Add(time.Duration(tick+1)*10*time.Second).Format("15:04:05"))
+	}
+	close(data)
+	waitOrTimeout(t, done, time.Second)
+
+	tables := strings.Split(out.String(), "*** Access Log Summary")
+	if !strings.Contains(tables[9], "anomaly") || strings.Contains(tables[9], "σ") {
+		t.Errorf("steady tick should have the column but no mark:\n%s", tables[9])
+	}
+	if !strings.Contains(tables[10], "rate +") {
+		t.Errorf("spike tick not marked:\n%s", tables[10])
+	}
+	if ev := snaps[9].Anomalies; len(ev) != 1 || ev[0].Metric != "rate" || ev[0].Value != 10 {
+		t.Errorf("snapshot anomalies = %+v, want the rate of 10/s", ev)
+	}
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/config"
+	"sync/atomic"
+)
+
+// inputStats counts what backpressure cost a single input, written by its
+// tailer and read by the aggregator when printing
+type inputStats struct {
+	name    string
+	blocked atomic.Int64 // nanoseconds spent waiting on a full channel
+	dropped atomic.Int64
+	state   atomic.Int32 // an inputState
+	// lines over the max line size, skipped by the tailer
+	oversize atomic.Int64
+	// nanoseconds spent waiting on rate limits, and whether it is waiting
+	throttled  atomic.Int64
+	throttling atomic.Bool
+}
+
+type inputState int32
+
+const (
+	inputOpening inputState = iota
+	inputWaiting            // open failed, retrying
+	inputTailing
+	inputErrored // file gone or reopen failing, retrying
+	inputDone
+	inputFailed
+)
+
+func (s inputState) String() string {
+	return [...]string{"opening", "waiting", "tailing", "errored", "done", "failed"}[s]
+}
+
+func (in *inputStats) setState(s inputState) { in.state.Store(int32(s)) }
+func (in *inputStats) getState() inputState  { return inputState(in.state.Load()) }
+
+// sender applies the backpressure policy of one input to the shared channel
+type sender struct {
+	policy     config.Backpressure
+	sampleRate int
+	stats      *inputStats
+	clk        clock.Clock
+	throttle   *throttle // nil when the input is not rate limited
+
+	// lines seen while the channel was full, for sampling
+	overflowed int
+}
+
+func newSender(flags config.Flags, clk clock.Clock, stats *inputStats) *sender {
+	return &sender{policy: flags.Backpressure, sampleRate: max(flags.SampleRate, 1), stats: stats, clk: clk}
+}
+
+func (s *sender) send(data chan<- []byte, rawRecord []byte) {
+	select {
+	case data <- rawRecord:
+		s.overflowed = 0
+		return
+	default:
+	}
+
+	// channel full
+	switch s.policy {
+	case config.BackpressureDrop:
+		s.stats.dropped.Add(1)
+		return
+	case config.BackpressureSample:
+		s.overflowed++
+		if (s.overflowed-1)%s.sampleRate != 0 {
+			s.stats.dropped.Add(1)
+			return
+		}
+	}
+
+	start := s.clk.Now()
+	data <- rawRecord
+	s.stats.blocked.Add(int64(s.clk.Since(start)))
+}
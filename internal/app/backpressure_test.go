@@ -0,0 +1,131 @@
+package app
+
+import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/config"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSender(t *testing.T) {
+	tests := []struct {
+		name        string
+		flags       config.Flags
+		bufSize     int
+		records     []string
+		wantData    []string
+		wantDropped int64
+		wantBlocked bool
+	}{
+		{
+			name:     "room in channel",
+			flags:    config.Flags{Backpressure: config.BackpressureDrop},
+			bufSize:  3,
+			records:  []string{"1", "2", "3"},
+			wantData: []string{"1", "2", "3"},
+		},
+		{
+			name:        "drop newest when full",
+			flags:       config.Flags{Backpressure: config.BackpressureDrop},
+			bufSize:     2,
+			records:     []string{"1", "2", "3", "4"},
+			wantData:    []string{"1", "2"},
+			wantDropped: 2,
+		},
+		{
+			name:        "sample one in three while full",
+			flags:       config.Flags{Backpressure: config.BackpressureSample, SampleRate: 3},
+			bufSize:     1,
+			records:     []string{"1", "2", "3", "4", "5", "6", "7", "8"},
+			wantData:    []string{"1", "2", "5", "8"},
+			wantDropped: 4,
+			wantBlocked: true,
+		},
+		{
+			name:        "block waits for room",
+			flags:       config.Flags{Backpressure: config.BackpressureBlock},
+			bufSize:     1,
+			records:     []string{"1", "2", "3"},
+			wantData:    []string{"1", "2", "3"},
+			wantBlocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make(chan []byte, tt.bufSize)
+			stats := &inputStats{name: "test.log"}
+			s := newSender(tt.flags, clock.Real{}, stats)
+
+			// only drain once everything was offered, so blocking sends
+			// have to wait for this reader
+			sent := make(chan struct{})
+			var got []string
+			drained := make(chan struct{})
+			go func() {
+				defer close(drained)
+				for {
+					select {
+					case <-sent:
+						for {
+							select {
+							case r := <-data:
+								got = append(got, string(r))
+							default:
+								return
+							}
+						}
+					case <-time.After(5 * time.Millisecond):
+						if len(data) == cap(data) {
+							got = append(got, string(<-data))
+						}
+					}
+				}
+			}()
+
+			for _, r := range tt.records {
+				s.send(data, []byte(r))
+			}
+			close(sent)
+			<-drained
+
+			if !reflect.DeepEqual(got, tt.wantData) {
+				t.Errorf("delivered %v, want %v", got, tt.wantData)
+			}
+			if d := stats.dropped.Load(); d != tt.wantDropped {
+				t.Errorf("dropped = %d, want %d", d, tt.wantDropped)
+			}
+			if b := stats.blocked.Load() > 0; b != tt.wantBlocked {
+				t.Errorf("blocked time recorded = %v, want %v", b, tt.wantBlocked)
+			}
+		})
+	}
+}
+
+func TestAggr_BackpressureFooter(t *testing.T) {
+	out := &bytes.Buffer{}
+	s := &mockSummarizer{formatOut: "SUMMARY\n"}
+
+	quiet := &inputStats{name: "quiet.log"}
+	busy := &inputStats{name: "busy.log"}
+	busy.dropped.Store(42)
+	busy.blocked.Store(int64(1500 * time.Millisecond))
+
+	data := make(chan []byte)
+	done := make(chan struct{})
+
+	go aggr(done, config.Flags{Interval: time.Hour}, clock.Real{}, data, s, []*inputStats{quiet, busy}, nil, out, nil)
+
+	close(data)
+	waitOrTimeout(t, done, time.Second)
+
+	if !strings.Contains(out.String(), "[busy.log] backpressure blocked: 1.5s, dropped: 42") {
+		t.Errorf("expected backpressure footer for busy input, got: %s", out.String())
+	}
+	if strings.Contains(out.String(), "quiet.log") {
+		t.Errorf("input without backpressure should not be reported, got: %s", out.String())
+	}
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/sink"
+	"accessAggregator/internal/term"
+	"accessAggregator/internal/tui"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// error output lines held while the dashboard is on screen, older ones are
+// dropped
+const heldErrLines = 1000
+
+// dashboard runs the -tui view while the pipeline runs
+type dashboard struct {
+	d       *tui.Dashboard
+	out     io.Writer
+	restore func() error
+	final   string // plain table of the final tick, printed after Stop
+	once    sync.Once
+	// stops the key reader, which closes keysDone once it returned
+	quit     chan struct{}
+	keysDone chan struct{}
+	// the error output while shown, see startDashboard
+	errOut *heldOutput
+}
+
+// startDashboard takes over out when it and stdin are terminals, and
+// returns nil otherwise so the caller keeps printing the plain table.
+// view is that of the other outputs. Pressing q calls cancel. Until stop,
+// errOut is to be replaced by db.errOut so nothing draws over the
+// dashboard.
+func startDashboard(out, errOut io.Writer, view accesslog.View, cancel context.CancelFunc) *dashboard {
+	f, ok := out.(*os.File)
+	if !ok || !term.IsTerminal(f.Fd()) || !term.IsTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	restore, err := term.MakeRaw(os.Stdin.Fd())
+	if err != nil {
+		return nil
+	}
+
+	size := func() (int, int) {
+		s, err := term.GetSize(f.Fd())
+		if err != nil || s.Cols == 0 {
+			return 80, 24
+		}
+		return s.Cols, s.Rows
+	}
+	db := &dashboard{d: tui.New(out, size, view), out: out, restore: restore, quit: make(chan struct{}), keysDone: make(chan struct{})}
+	db.errOut = &heldOutput{w: errOut, show: db.d.SetError}
+	db.d.Start()
+
+	go func() {
+		defer close(db.keysDone)
+		readKeys(os.Stdin, db.quit, func(k byte) {
+			if db.d.Key(k) {
+				cancel()
+			}
+		})
+	}()
+	return db
+}
+
+// readKeys passes every byte of r to key until quit is closed. In raw mode
+// a read on a terminal returns empty every tenth of a second, see
+// term.MakeRaw, which is when quit is checked.
+func readKeys(r io.Reader, quit <-chan struct{}, key func(byte)) {
+	buf := make([]byte, 16)
+	for {
+		select {
+		case <-quit:
+			return
+		default:
+		}
+		n, err := r.Read(buf)
+		for _, k := range buf[:n] {
+			key(k)
+		}
+		if err != nil && err != io.EOF {
+			return
+		}
+	}
+}
+
+func (db *dashboard) onTick(snap sink.Snapshot, summaries accesslog.Summarizer) {
+	db.d.Update(snap)
+	if snap.Final {
+		db.final = summaries.Format(snap.Time)
+	}
+}
+
+// heldOutput stands in for the error output while the dashboard is shown,
+// which shares the terminal: lines are kept until release and the latest
+// goes to the status bar.
+type heldOutput struct {
+	mu       sync.Mutex
+	w        io.Writer
+	show     func(line string)
+	lines    []string
+	dropped  int
+	released bool
+}
+
+func (h *heldOutput) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.released {
+		return h.w.Write(p)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(p), "\n"), "\n")
+	h.lines = append(h.lines, lines...)
+	if over := len(h.lines) - heldErrLines; over > 0 {
+		h.lines = h.lines[over:]
+		h.dropped += over
+	}
+	h.show(lines[len(lines)-1])
+	return len(p), nil
+}
+
+// release writes the held lines, later writes go straight through
+func (h *heldOutput) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.dropped > 0 {
+		fmt.Fprintf(h.w, "... %d earlier lines dropped while the dashboard was shown\n", h.dropped)
+	}
+	for _, l := range h.lines {
+		fmt.Fprintln(h.w, l)
+	}
+	h.lines, h.released = nil, true
+}
+
+// stop restores the terminal and prints the final table and the held error
+// output, only once
+func (db *dashboard) stop() {
+	db.once.Do(func() {
+		db.d.Stop()
+		// the reader must be done before the terminal blocks reads again
+		close(db.quit)
+		<-db.keysDone
+		db.restore()
+		io.WriteString(db.out, db.final)
+		db.errOut.release()
+	})
+}
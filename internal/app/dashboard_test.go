@@ -0,0 +1,91 @@
+package app
+
+import (
+	"accessAggregator/internal/accesslog"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartDashboard_NotATerminal(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, out := range []io.Writer{&bytes.Buffer{}, f} {
+		if db := startDashboard(out, io.Discard, accesslog.View{}, func() {}); db != nil {
+			t.Errorf("startDashboard(%T) took over a non terminal", out)
+		}
+	}
+}
+
+func TestHeldOutput(t *testing.T) {
+	var w bytes.Buffer
+	var shown []string
+	h := &heldOutput{w: &w, show: func(line string) { shown = append(shown, line) }}
+
+	for i := range heldErrLines + 2 {
+		fmt.Fprintf(h, "line %d\n", i)
+	}
+	if w.Len() != 0 {
+		t.Errorf("held output written before release: %q", w.String())
+	}
+	if last := shown[len(shown)-1]; last != fmt.Sprintf("line %d", heldErrLines+1) {
+		t.Errorf("status bar shows %q, want the latest line", last)
+	}
+
+	h.release()
+	fmt.Fprintln(h, "after")
+	got := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if len(got) != heldErrLines+2 || !strings.Contains(got[0], "2 earlier lines dropped") ||
+		got[1] != "line 2" || got[len(got)-1] != "after" {
+		t.Errorf("released %d lines: first %q %q, last %q", len(got), got[0], got[1], got[len(got)-1])
+	}
+}
+
+// idleTerminal reads like a raw terminal: its keys, then nothing after a
+// short wait
+type idleTerminal struct{ keys []byte }
+
+func (r *idleTerminal) Read(p []byte) (int, error) {
+	if len(r.keys) == 0 {
+		time.Sleep(time.Millisecond)
+		return 0, io.EOF
+	}
+	n := copy(p, r.keys)
+	r.keys = r.keys[n:]
+	return n, nil
+}
+
+func TestReadKeys_StopsOnQuit(t *testing.T) {
+	quit := make(chan struct{})
+	keys := make(chan byte, 2)
+	done := make(chan struct{})
+	go func() {
+		readKeys(&idleTerminal{keys: []byte("sq")}, quit, func(k byte) { keys <- k })
+		close(done)
+	}()
+	if got := string([]byte{<-keys, <-keys}); got != "sq" {
+		t.Errorf("keys = %q, want %q", got, "sq")
+	}
+
+	// an idle terminal does not end the reader, quit does
+	select {
+	case <-done:
+		t.Fatal("readKeys returned before quit")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(quit)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("readKeys did not stop on quit")
+	}
+}
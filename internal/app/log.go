@@ -0,0 +1,17 @@
+package app
+
+import (
+	"accessAggregator/internal/config"
+	"io"
+	"log/slog"
+)
+
+// newLogger writes the agent's own diagnostics, as opposed to the summaries
+// on out, so a log collector can parse them.
+func newLogger(flags config.Flags, w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: flags.LogLevel}
+	if flags.LogFormat == config.LogJSON {
+		return slog.New(slog.NewJSONHandler(w, opts))
+	}
+	return slog.New(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/alert"
+	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	log := newLogger(config.Flags{LogFormat: config.LogJSON, LogLevel: slog.LevelWarn}, &buf)
+	log.Info("hidden")
+	log.Error("input failed", "input", "a.log")
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if got["level"] != "ERROR" || got["msg"] != "input failed" || got["input"] != "a.log" {
+		t.Errorf("unexpected record %v", got)
+	}
+
+	buf.Reset()
+	newLogger(config.Flags{}, &buf).Info("shutting down", "reason", "canceled")
+	if line := buf.String(); !strings.Contains(line, `level=INFO msg="shutting down" reason=canceled`) {
+		t.Errorf("unexpected text record %q", line)
+	}
+}
+
+func TestAlertSink_Logs(t *testing.T) {
+	rule, err := alert.ParseRule("error_ratio > 0.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	log := newLogger(config.Flags{LogFormat: config.LogJSON}, &buf)
+	s := alertSink(config.Flags{Alerts: []alert.Rule{rule}}, log)
+
+	base := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	for i, errs := range []int{10, 20, 20} {
+		s.Write(sink.Snapshot{Time: base.Add(time.Duration(i) * 10 * time.Second), Rows: []accesslog.Row{
+			{Host: "a.com", Requests: 10 * (i + 1), ByClass: [6]int{5: errs}},
+		}})
+	}
+	s.Close() // delivery is asynchronous
+
+	var got []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("alert output is not JSON: %q", line)
+		}
+		got = append(got, fmt.Sprint(rec["level"], " ", rec["msg"], " ", rec["host"], " ", rec["rule"]))
+	}
+	want := []string{"WARN alert firing a.com error_ratio > 0.5", "INFO alert resolved a.com error_ratio > 0.5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("logged %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/config"
+	"cmp"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket holding one second of rate. A take larger than
+// what is left borrows from the future and waits for it, so records bigger
+// than the bucket still pass.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64 // per second
+	tokens float64
+	last   time.Time
+}
+
+// newLimiter returns nil for rate 0, which never limits.
+func newLimiter(rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: rate}
+}
+
+// reserve takes n tokens and says how long to wait before using them.
+func (l *limiter) reserve(now time.Time, n float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.last.IsZero() {
+		l.tokens = l.rate
+	} else {
+		l.tokens = min(l.rate, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	l.tokens -= n
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// throttle paces the reads of one input by its own limits and the global
+// ones shared with every input.
+type throttle struct {
+	lines []*limiter
+	bytes []*limiter
+	// only limit until the input first reaches the end, so a backlog is read
+	// slowly and live lines are not
+	catchUp bool
+	live    bool
+
+	clk   clock.Clock
+	log   *slog.Logger
+	stats *inputStats
+	// whether the last wait was throttled, to log transitions only
+	waiting bool
+	// when set, bytes limits are charged what the input read, skipped lines
+	// included, rather than the record sizes
+	read    byteCounter
+	charged int64
+}
+
+// newThrottle returns nil when no limit applies to the input called name.
+func newThrottle(flags config.Flags, name string, globalLines, globalBytes *limiter, clk clock.Clock, log *slog.Logger, stats *inputStats) *throttle {
+	fileOpts := flags.FileOptions[name]
+	lines := newLimiter(cmp.Or(fileOpts.RateLines, flags.RateLines))
+	bytes := newLimiter(cmp.Or(fileOpts.RateBytes, flags.RateBytes))
+	if lines == nil && bytes == nil && globalLines == nil && globalBytes == nil {
+		return nil
+	}
+	return &throttle{
+		lines:   []*limiter{lines, globalLines},
+		bytes:   []*limiter{bytes, globalBytes},
+		catchUp: flags.CatchUp,
+		clk:     clk,
+		log:     log,
+		stats:   stats,
+	}
+}
+
+// countBytes charges bytes limits what read says was consumed, see wait.
+func (th *throttle) countBytes(read byteCounter) {
+	if th == nil {
+		return
+	}
+	th.read, th.charged = read, read.BytesRead()
+}
+
+// wait blocks until a record of n bytes may pass, false when ctx is done
+// first. With countBytes, n is replaced by the bytes read since the last
+// wait.
+func (th *throttle) wait(ctx context.Context, n int) bool {
+	if th == nil || th.live {
+		return true
+	}
+
+	if th.read != nil {
+		read := th.read.BytesRead()
+		n, th.charged = int(read-th.charged), read
+	}
+
+	now := th.clk.Now()
+	var delay time.Duration
+	for _, l := range th.lines {
+		if l != nil {
+			delay = max(delay, l.reserve(now, 1))
+		}
+	}
+	for _, l := range th.bytes {
+		if l != nil {
+			delay = max(delay, l.reserve(now, float64(n)))
+		}
+	}
+	if delay == 0 {
+		if th.waiting {
+			th.waiting = false
+			th.stats.throttling.Store(false)
+			th.log.Debug("throttle released")
+		}
+		return true
+	}
+
+	if !th.waiting {
+		th.waiting = true
+		th.stats.throttling.Store(true)
+		th.log.Debug("throttling input", "delay", delay)
+	}
+	th.stats.throttled.Add(int64(delay))
+	select {
+	case <-ctx.Done():
+		return false
+	case <-th.clk.After(delay):
+		return true
+	}
+}
+
+// caughtUp is called when the input reached its end, an idle input is not
+// throttling.
+func (th *throttle) caughtUp() {
+	if th == nil {
+		return
+	}
+	if th.waiting {
+		th.waiting = false
+		th.stats.throttling.Store(false)
+		th.log.Debug("throttle released")
+	}
+	if !th.catchUp || th.live {
+		return
+	}
+	th.live = true
+	th.log.Info("caught up, no longer throttled")
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/config"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Reserve(t *testing.T) {
+	now := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	l := newLimiter(10)
+
+	// starts with a second worth of tokens
+	for i := range 10 {
+		if d := l.reserve(now, 1); d != 0 {
+			t.Fatalf("reserve %d waited %v, want 0", i, d)
+		}
+	}
+	if d := l.reserve(now, 1); d != 100*time.Millisecond {
+		t.Errorf("reserve past the burst = %v, want 100ms", d)
+	}
+	// refills at the rate, never past one second worth
+	if d := l.reserve(now.Add(time.Hour), 10); d != 0 {
+		t.Errorf("reserve after a refill = %v, want 0", d)
+	}
+	if d := l.reserve(now.Add(time.Hour), 5); d != 500*time.Millisecond {
+		t.Errorf("reserve past a refilled burst = %v, want 500ms", d)
+	}
+
+	if newLimiter(0) != nil {
+		t.Error("newLimiter(0) should not limit")
+	}
+}
+
+func TestThrottle_CatchUp(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+	stats := &inputStats{}
+	flags := config.Flags{RateBytes: 100, CatchUp: true}
+	th := newThrottle(flags, "a.log", nil, nil, clk, slog.New(slog.DiscardHandler), stats)
+
+	if !th.wait(context.Background(), 100) {
+		t.Fatal("first second of bytes should pass")
+	}
+
+	passed := make(chan bool, 1)
+	go func() { passed <- th.wait(context.Background(), 50) }()
+	clk.BlockUntil(1)
+	if !stats.throttling.Load() {
+		t.Error("expected the input to report throttling")
+	}
+	clk.Advance(500 * time.Millisecond)
+	if !<-passed {
+		t.Fatal("wait() = false, want true")
+	}
+	if got := time.Duration(stats.throttled.Load()); got != 500*time.Millisecond {
+		t.Errorf("throttled = %v, want 500ms", got)
+	}
+
+	// live lines are not limited once caught up
+	th.caughtUp()
+	if !th.wait(context.Background(), 1000) || stats.throttling.Load() {
+		t.Error("expected no throttling after catching up")
+	}
+}
+
+func TestThrottle_ReleasedAtEOF(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+	stats := &inputStats{}
+	th := newThrottle(config.Flags{RateBytes: 100}, "a.log", nil, nil, clk, slog.New(slog.DiscardHandler), stats)
+
+	th.wait(context.Background(), 100)
+	passed := make(chan bool, 1)
+	go func() { passed <- th.wait(context.Background(), 50) }()
+	clk.BlockUntil(1)
+	clk.Advance(500 * time.Millisecond)
+	<-passed
+	if !stats.throttling.Load() {
+		t.Fatal("expected the input to report throttling")
+	}
+
+	// an input waiting for new lines is not throttled, catch-up or not
+	th.caughtUp()
+	if stats.throttling.Load() {
+		t.Error("expected throttling to clear at EOF")
+	}
+	// the limit still applies to what comes next
+	go func() { passed <- th.wait(context.Background(), 100) }()
+	clk.BlockUntil(1)
+	if !stats.throttling.Load() {
+		t.Error("expected the limit to apply after EOF without catch-up")
+	}
+	clk.Advance(time.Second)
+	<-passed
+}
+
+func TestNewThrottle_Unlimited(t *testing.T) {
+	if th := newThrottle(config.Flags{}, "a.log", nil, nil, clock.Real{}, nil, &inputStats{}); th != nil {
+		t.Error("expected no throttle without limits")
+	}
+	flags := config.Flags{FileOptions: map[string]config.FileOptions{"a.log": {RateLines: 5}}}
+	if th := newThrottle(flags, "b.log", nil, nil, clock.Real{}, nil, &inputStats{}); th != nil {
+		t.Error("expected file limits to only apply to their file")
+	}
+	if th := newThrottle(flags, "b.log", nil, newLimiter(10), clock.Real{}, nil, &inputStats{}); th == nil {
+		t.Error("expected the global limit to apply to every file")
+	}
+}
+
+type bytesRead int64
+
+func (b *bytesRead) BytesRead() int64 { return int64(*b) }
+
+func TestThrottle_ChargesBytesRead(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+	stats := &inputStats{}
+	th := newThrottle(config.Flags{RateBytes: 100}, "a.log", nil, nil, clk, slog.New(slog.DiscardHandler), stats)
+	read := bytesRead(10)
+	th.countBytes(&read) // bytes read before the start are not charged
+
+	// a 10 byte record after a skipped 190 byte line is charged 200 bytes
+	read += 200
+	passed := make(chan bool, 1)
+	go func() { passed <- th.wait(context.Background(), 10) }()
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	<-passed
+	if got := time.Duration(stats.throttled.Load()); got != time.Second {
+		t.Errorf("throttled = %v, want 1s", got)
+	}
+}
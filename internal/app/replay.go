@@ -0,0 +1,210 @@
+package app
+
+import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/tailer"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replay feeds a historical log through the pipeline as if it were live:
+// records are paced by the deltas of their times, scaled by speed, and the
+// pipeline clock follows the record times, so ticks fall on the same event
+// times they would have live. Records are taken in the order read, so one
+// input only.
+type replay struct {
+	ctx   context.Context
+	clk   *clock.Fake
+	wall  clock.Clock // paces the records
+	speed float64     // 0 for as fast as possible
+	// records sent but not taken by the aggregator yet
+	queued func() int
+	// closed once the aggregator's ticker exists, see started
+	ready chan struct{}
+	// signaled by the aggregator after every record and tick, see progressed
+	progress chan struct{}
+	ticks    atomic.Int64
+
+	mu         sync.Mutex
+	eventStart time.Time
+	wallStart  time.Time
+}
+
+// newReplay returns a replay whose clock starts at the time of the first
+// record, and whose pacing waits on wall. queued must be set before the
+// first record, and the aggregator reports to it, see started and
+// progressed.
+func newReplay(ctx context.Context, wall clock.Clock, speed float64) *replay {
+	return &replay{
+		ctx:      ctx,
+		clk:      clock.NewFake(time.Time{}),
+		wall:     wall,
+		speed:    speed,
+		ready:    make(chan struct{}),
+		progress: make(chan struct{}, 1),
+	}
+}
+
+// started is called by the aggregator once its ticker exists.
+func (r *replay) started() {
+	if r != nil {
+		close(r.ready)
+	}
+}
+
+// progressed is called by the aggregator after every record it took and
+// every tick it printed.
+func (r *replay) progressed(tick bool) {
+	if r == nil {
+		return
+	}
+	if tick {
+		r.ticks.Add(1)
+	}
+	select {
+	case r.progress <- struct{}{}:
+	default:
+	}
+}
+
+// at holds a record of time t back until it is due, then moves the clock to
+// t, letting the aggregator see every tick on the way. False when ctx is
+// done first.
+func (r *replay) at(t time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.eventStart.IsZero() {
+		// the ticker is shifted along, and must exist for the first record
+		// to see its ticks
+		select {
+		case <-r.ctx.Done():
+			return false
+		case <-r.ready:
+		}
+		r.eventStart, r.wallStart = t, r.wall.Now()
+		r.clk.Rebase(t)
+	}
+	if r.speed > 0 {
+		elapsed := time.Duration(float64(t.Sub(r.eventStart)) / r.speed)
+		if wait := elapsed - r.wall.Since(r.wallStart); wait > 0 {
+			select {
+			case <-r.ctx.Done():
+				return false
+			case <-r.wall.After(wait):
+			}
+		}
+	}
+
+	for {
+		next, ok := r.clk.Next()
+		if !ok || next.After(t) {
+			break
+		}
+		// records before the tick are aggregated before it, and the tick is
+		// printed before records after it
+		if !r.until(func() bool { return r.queued() == 0 }) {
+			return false
+		}
+		ticked := r.ticks.Load() + 1
+		r.clk.Advance(next.Sub(r.clk.Now()))
+		if !r.until(func() bool { return r.ticks.Load() >= ticked }) {
+			return false
+		}
+	}
+	if d := t.Sub(r.clk.Now()); d > 0 {
+		r.clk.Advance(d)
+	}
+	return true
+}
+
+// until waits for cond, checking it again whenever the aggregator
+// progressed.
+func (r *replay) until(cond func() bool) bool {
+	for !cond() {
+		select {
+		case <-r.ctx.Done():
+			return false
+		case <-r.progress:
+		}
+	}
+	return true
+}
+
+// pace holds every record of tf back until it is due.
+func (r *replay) pace(tf tailer.Tailer) tailer.Tailer {
+	return &pacedTailer{Tailer: tf, replay: r}
+}
+
+type pacedTailer struct {
+	tailer.Tailer
+	replay *replay
+}
+
+func (p *pacedTailer) GetRawRecord() ([]byte, error) {
+	rawRecord, err := p.Tailer.GetRawRecord()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := RecordTime(rawRecord); ok && !p.replay.at(t) {
+		return nil, tailer.ErrExhausted
+	}
+	return rawRecord, nil
+}
+
+func (p *pacedTailer) Err() error {
+	if r, ok := p.Tailer.(retryingTailer); ok {
+		return r.Err()
+	}
+	return nil
+}
+
+func (p *pacedTailer) Flush() []byte {
+	if f, ok := p.Tailer.(pendingFlusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (p *pacedTailer) Oversize() int64 {
+	if o, ok := p.Tailer.(oversizeCounter); ok {
+		return o.Oversize()
+	}
+	return 0
+}
+
+// exhaustAtEOF ends a replayed file at its current end instead of following
+// it. It sits below any framing, so a last multiline record is flushed. A
+// file that is gone or failing has no end to reach, its error ends the
+// replay instead.
+type exhaustAtEOF struct {
+	tailer.Tailer
+}
+
+func (e exhaustAtEOF) GetRawRecord() ([]byte, error) {
+	rawRecord, err := e.Tailer.GetRawRecord()
+	if err == io.EOF {
+		if err := e.Err(); err != nil {
+			return nil, err
+		}
+		return nil, tailer.ErrExhausted
+	}
+	return rawRecord, err
+}
+
+func (e exhaustAtEOF) Err() error {
+	if r, ok := e.Tailer.(retryingTailer); ok {
+		return r.Err()
+	}
+	return nil
+}
+
+func (e exhaustAtEOF) Oversize() int64 {
+	if o, ok := e.Tailer.(oversizeCounter); ok {
+		return o.Oversize()
+	}
+	return 0
+}
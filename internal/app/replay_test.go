@@ -0,0 +1,94 @@
+package app
+
+import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/tailer"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReplay_PacesOnWallClock(t *testing.T) {
+	wall := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	rp := newReplay(context.Background(), wall, 2)
+	rp.queued = func() int { return 0 }
+	ticker := rp.clk.NewTicker(time.Minute)
+	defer ticker.Stop()
+	rp.started()
+
+	start := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	if !rp.at(start) || !rp.clk.Now().Equal(start) {
+		t.Fatalf("clock at %v after the first record, want %v", rp.clk.Now(), start)
+	}
+
+	// ten seconds of records at twice the speed take five
+	passed := make(chan bool, 1)
+	go func() { passed <- rp.at(start.Add(10 * time.Second)) }()
+	wall.BlockUntil(1)
+	wall.Advance(5 * time.Second)
+	if !<-passed {
+		t.Fatal("at() = false, want true")
+	}
+	if got := rp.clk.Now(); !got.Equal(start.Add(10 * time.Second)) {
+		t.Errorf("clock at %v, want %v", got, start.Add(10*time.Second))
+	}
+}
+
+func TestReplay_WaitsForEveryTick(t *testing.T) {
+	rp := newReplay(context.Background(), clock.Real{}, 0)
+	rp.queued = func() int { return 0 }
+	ticker := rp.clk.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// stands in for aggr
+	var ticks []time.Time
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case tick := <-ticker.C():
+				ticks = append(ticks, tick)
+				rp.progressed(true)
+			}
+		}
+	}()
+	rp.started()
+
+	start := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	if !rp.at(start) || !rp.at(start.Add(3500*time.Millisecond)) {
+		t.Fatal("at() = false, want true")
+	}
+	want := []time.Time{start.Add(time.Second), start.Add(2 * time.Second), start.Add(3 * time.Second)}
+	if !slices.EqualFunc(ticks, want, time.Time.Equal) {
+		t.Errorf("ticks = %v, want %v", ticks, want)
+	}
+}
+
+type failingTailer struct{ err error }
+
+func (f failingTailer) GetRawRecord() ([]byte, error) { return nil, io.EOF }
+func (f failingTailer) Close() error                  { return nil }
+func (f failingTailer) Err() error                    { return f.err }
+
+func TestExhaustAtEOF_FailingFile(t *testing.T) {
+	gone := errors.New("file gone")
+	rp := newReplay(context.Background(), clock.Real{}, 0)
+	tf := rp.pace(exhaustAtEOF{failingTailer{gone}})
+	if _, err := tf.GetRawRecord(); err != gone {
+		t.Errorf("GetRawRecord() error = %v, want %v", err, gone)
+	}
+	if r, ok := tf.(retryingTailer); !ok || r.Err() != gone {
+		t.Error("expected Err() to reach through the replay wrappers")
+	}
+
+	tf = exhaustAtEOF{failingTailer{}}
+	if _, err := tf.GetRawRecord(); err != tailer.ErrExhausted {
+		t.Errorf("GetRawRecord() error = %v, want ErrExhausted", err)
+	}
+}
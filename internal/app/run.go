@@ -2,39 +2,282 @@ package app
 
 import (
 	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/clock"
 	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
+	"accessAggregator/internal/tailer"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"sync"
+	"time"
 )
 
+// Input is one named record stream. Open runs on the input's own goroutine,
+// so an input that fails is reported without stopping the others. log
+// already carries the input name.
+type Input struct {
+	Name string
+	Open func(log *slog.Logger) (tailer.Tailer, error)
+	// joins the lines of the opened Tailer into multiline records, unless
+	// it is tailer.FrameLines
+	Framing tailer.FramerOptions
+}
+
+// FileInputs tails files with the options optsFor gives each, see
+// FileOpener.
+func FileInputs(files []string, optsFor func(file string) tailer.Options) []Input {
+	inputs := make([]Input, len(files))
+	for i, file := range files {
+		inputs[i] = Input{Name: file, Open: FileOpener(file, func() tailer.Options { return optsFor(file) })}
+	}
+	return inputs
+}
+
+// FileOpener is an Input.Open tailing file with the options optsFor gives,
+// the logger is the one given to Open. Once an open has failed, a start at
+// the end becomes a start at the beginning: the file appeared after tailing
+// began, so everything in it is new.
+func FileOpener(file string, optsFor func() tailer.Options) func(log *slog.Logger) (tailer.Tailer, error) {
+	var failed bool
+	return func(log *slog.Logger) (tailer.Tailer, error) {
+		opts := optsFor()
+		opts.Logger = log
+		if failed && (opts.Start.Kind == tailer.StartDefault || opts.Start.Kind == tailer.StartEnd) {
+			opts.Start = tailer.StartPosition{Kind: tailer.StartBeginning}
+		}
+		tf, err := tailer.NewTailFileWithOptions(file, tailer.OsFS{}, opts)
+		failed = err != nil
+		return tf, err
+	}
+}
+
+// TickFunc is called on the aggregator goroutine right after a summary is
+// printed, summaries is only safe to use during the call.
+type TickFunc func(snap sink.Snapshot, summaries accesslog.Summarizer)
+
+type Options struct {
+	Clock  clock.Clock // defaults to clock.Real
+	Inputs []Input     // defaults to FileInputs of flags.Files
+	OnTick TickFunc
+	// added to the sinks of flags.Sinks, keyed by name
+	Sinks map[string]sink.Sink
+	// defaults to flags.LogFormat and flags.LogLevel on outErr
+	Logger *slog.Logger
+}
+
 func Run(ctx context.Context, flags config.Flags, out io.Writer, outErr io.Writer) error {
-	summaries := accesslog.NewSummaries()
+	return RunWithOptions(ctx, flags, Options{}, out, outErr)
+}
+
+// RunWithOptions is Run for embedders: the pipeline ends when ctx is done or
+// every input is exhausted.
+func RunWithOptions(ctx context.Context, flags config.Flags, runOpts Options, out io.Writer, outErr io.Writer) error {
+	// the dashboard draws on out, degrading to the plain table when out is
+	// not a terminal
+	var db *dashboard
+	termOut := out
+	if flags.TUI {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		if db = startDashboard(out, outErr, flags.View, cancel); db != nil {
+			defer db.stop()
+			userTick := runOpts.OnTick
+			runOpts.OnTick = func(snap sink.Snapshot, summaries accesslog.Summarizer) {
+				db.onTick(snap, summaries)
+				if userTick != nil {
+					userTick(snap, summaries)
+				}
+			}
+			out = io.Discard
+			outErr = db.errOut
+		}
+	}
+
+	log := runOpts.Logger
+	if log == nil {
+		log = newLogger(flags, outErr)
+	}
+
+	clk := runOpts.Clock
+	if clk == nil {
+		clk = clock.Real{}
+	}
+	// a replay drives the aggregator by record times, reading and waiting
+	// on inputs keeps clk
+	tickClk := clk
+	var rp *replay
+	if flags.Replay {
+		rp = newReplay(ctx, clk, flags.ReplaySpeed)
+		tickClk = rp.clk
+	}
+	var retry *tailer.Retry
+	if flags.WaitForFiles {
+		retry = &flags.Retry
+	}
+	sources := runOpts.Inputs
+	if sources == nil {
+		sources = FileInputs(flags.Files, func(file string) tailer.Options {
+			fileOpts := flags.FileOptions[file]
+			start := flags.Start
+			if flags.Replay && start.Kind == tailer.StartDefault {
+				start.Kind = tailer.StartBeginning
+			}
+			return tailer.Options{
+				FromStart:       flags.FromStart,
+				Start:           start,
+				TimeOf:          RecordTime,
+				Retry:           retry,
+				Clock:           clk,
+				Identity:        fileOpts.Identity,
+				FingerprintSize: fileOpts.FingerprintSize,
+				MaxLineSize:     flags.MaxLineSize,
+			}
+		})
+		for i, file := range flags.Files {
+			fileOpts := flags.FileOptions[file]
+			sources[i].Framing = tailer.FramerOptions{
+				Framing:      fileOpts.Framing,
+				Start:        fileOpts.Start,
+				FlushTimeout: fileOpts.FlushTimeout,
+				MaxSize:      flags.MaxLineSize,
+			}
+		}
+	}
+
+	opts := accesslog.Options{
+		DistinctField:     flags.DistinctField,
+		DistinctPrecision: uint8(flags.DistinctPrecision),
+		MaxGroups:         flags.MaxGroups,
+		Overflow:          flags.Overflow,
+		SLOs:              flags.SLOs,
+		View:              flags.View,
+		// record time under replay
+		Clock: tickClk,
+	}
+	var summaries accesslog.Summarizer
+	if flags.Workers > 1 {
+		sharded, err := accesslog.NewSharded(opts, flags.Workers, flags.Workers)
+		if err != nil {
+			return err
+		}
+		defer sharded.Close()
+		summaries = sharded
+	} else {
+		aggregator, err := accesslog.NewAggregator(opts)
+		if err != nil {
+			return err
+		}
+		summaries = aggregator
+	}
+
+	onTick := runOpts.OnTick
+	if len(flags.Sinks) > 0 || len(runOpts.Sinks) > 0 {
+		sinks, err := openSinks(flags.Sinks, flags.View)
+		if err != nil {
+			return err
+		}
+		maps.Copy(sinks, runOpts.Sinks)
+		fanOut := sink.NewFanOut(sinks, func(name string, err error) {
+			log.Error("sink write failed", "sink", name, "err", err)
+		})
+		// runs after aggr is done, so the final snapshot is queued
+		defer fanOut.Close(sinkCloseTimeout)
+
+		userTick := onTick
+		onTick = func(snap sink.Snapshot, summaries accesslog.Summarizer) {
+			fanOut.Publish(snap)
+			if userTick != nil {
+				userTick(snap, summaries)
+			}
+		}
+	}
+	if len(flags.Alerts) > 0 {
+		// every tick is evaluated, rules count them
+		alerts := alertSink(flags, log)
+		defer closeSink("alerts", alerts, sinkCloseTimeout, log)
+
+		userTick := onTick
+		onTick = func(snap sink.Snapshot, summaries accesslog.Summarizer) {
+			if err := alerts.Write(snap); err != nil {
+				log.Error("sink write failed", "sink", "alerts", "err", err)
+			}
+			if userTick != nil {
+				userTick(snap, summaries)
+			}
+		}
+	}
 
 	// scale with * 25, but min 100 and max 10000
-	bufSize := min(max(len(flags.Files)*25, 100), 10000)
+	bufSize := min(max(len(sources)*25, 100), 10000)
+	if flags.BufferSize > 0 {
+		bufSize = flags.BufferSize
+	}
 	data := make(chan []byte, bufSize)
+	if rp != nil {
+		rp.queued = func() int { return len(data) }
+	}
 
 	// producer
+	globalLines, globalBytes := newLimiter(flags.GlobalRateLines), newLimiter(flags.GlobalRateBytes)
 	var wg sync.WaitGroup
-	for _, file := range flags.Files {
+	inputs := make([]*inputStats, len(sources))
+	errs := make([]error, len(sources))
+	for i, in := range sources {
+		inputs[i] = &inputStats{name: in.Name}
+		log := log.With("input", in.Name)
+		snd := newSender(flags, clk, inputs[i])
+		snd.throttle = newThrottle(flags, in.Name, globalLines, globalBytes, clk, log, inputs[i])
 		wg.Go(func() {
-			if err := tail(ctx, file, flags.FromStart, data); err != nil {
-				fmt.Fprintf(outErr, red+"[%s] error: %v\n"+reset, file, err)
+			if err := tail(ctx, clk, in, log, retry, rp, data, snd); err != nil {
+				inputs[i].setState(inputFailed)
+				log.Error("input failed", "err", err)
+				errs[i] = fmt.Errorf("%s: %w", in.Name, err)
+				return
 			}
+			inputs[i].setState(inputDone)
+			log.Debug("input done")
 		})
 	}
 
 	// consumer
 	aggrDone := make(chan struct{})
-	go aggr(aggrDone, flags, data, summaries, out)
+	go aggr(aggrDone, flags, tickClk, data, summaries, inputs, onTick, out, rp)
 
 	wg.Wait()
+	log.Info("shutting down", "reason", shutdownReason(ctx))
 
 	close(data)
 	<-aggrDone
 
-	fmt.Fprintln(out, "Gracefully shut down...")
+	if db != nil {
+		db.stop()
+	}
+	fmt.Fprintln(termOut, "Gracefully shut down...")
+	log.Info("shutdown complete")
+	if rp != nil {
+		// a replay is of its one input, which failing fails the run
+		return errors.Join(errs...)
+	}
 	return nil
 }
+
+// RecordTime reads the time of a raw record, for starting a file by time.
+func RecordTime(rawRecord []byte) (time.Time, bool) {
+	r, err := accesslog.NewRecord(rawRecord)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return r.Time, true
+}
+
+func shutdownReason(ctx context.Context) string {
+	if ctx.Err() != nil {
+		return "canceled"
+	}
+	return "inputs exhausted"
+}
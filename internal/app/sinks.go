@@ -0,0 +1,149 @@
+package app
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/alert"
+	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// how long shutdown waits for sinks to flush the final snapshot
+const sinkCloseTimeout = 5 * time.Second
+
+// openSinks opens every spec, each seeing its rows through view
+func openSinks(specs []sink.Spec, view accesslog.View) (map[string]sink.Sink, error) {
+	sinks := make(map[string]sink.Sink, len(specs))
+	closeAll := func() {
+		for _, opened := range sinks {
+			opened.Close()
+		}
+	}
+	for _, spec := range specs {
+		// keyed by spec, a repeat would replace a sink still open
+		if _, ok := sinks[spec.String()]; ok {
+			closeAll()
+			return nil, fmt.Errorf("duplicate sink: %s", spec)
+		}
+		s, err := openSink(spec, view)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("sink %s: %w", spec, err)
+		}
+		if _, ok := s.(*sink.StatsD); !ok {
+			// statsd applies view itself, to increments
+			s = sink.WithView(s, view)
+		}
+		sinks[spec.String()] = s
+	}
+	return sinks, nil
+}
+
+func openSink(spec sink.Spec, view accesslog.View) (sink.Sink, error) {
+	switch spec.Kind {
+	case "json":
+		j, err := sink.OpenJSONFile(spec.Target)
+		if err != nil {
+			return nil, err
+		}
+		j.Columns = view.Columns
+		return j, nil
+	case "statsd", "dogstatsd":
+		opts := sink.StatsDOptions{
+			Prefix:    spec.Params.Get("prefix"),
+			DogStatsD: spec.Kind == "dogstatsd",
+			Tags:      spec.Params["tag"],
+			View:      view,
+		}
+		mtu, err := intParam(spec, "mtu")
+		if err != nil {
+			return nil, err
+		}
+		opts.MaxPacket = mtu
+		return sink.NewStatsD(spec.Target, opts)
+	case "graphite":
+		backlog, err := intParam(spec, "backlog")
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewGraphite(spec.Target, sink.GraphiteOptions{Prefix: spec.Params.Get("prefix"), Backlog: backlog}), nil
+	case "influx":
+		backlog, err := intParam(spec, "backlog")
+		if err != nil {
+			return nil, err
+		}
+		opts := sink.InfluxOptions{
+			Measurement: spec.Params.Get("measurement"),
+			Token:       spec.Params.Get("token"),
+			Backlog:     backlog,
+		}
+		// the spec took the query string of the write URL, hand back what
+		// the sink does not use itself (org, bucket, precision...)
+		target := spec.Target
+		query := url.Values{}
+		for k, v := range spec.Params {
+			if k != "measurement" && k != "token" && k != "backlog" {
+				query[k] = v
+			}
+		}
+		if len(query) > 0 {
+			target += "?" + query.Encode()
+		}
+		return sink.OpenInflux(target, opts)
+	}
+	return nil, fmt.Errorf("unknown sink kind %q", spec.Kind)
+}
+
+// intParam reads an optional positive integer param, 0 when absent
+func intParam(spec sink.Spec, name string) (int, error) {
+	v := spec.Params.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, v)
+	}
+	return n, nil
+}
+
+// alertSink evaluates the -alert rules on every snapshot, logging state
+// changes and POSTing them to -alert-webhook when set. It is written to on
+// the aggregator goroutine rather than through a FanOut, which may drop
+// snapshots, see alert.Sink.
+func alertSink(flags config.Flags, log *slog.Logger) sink.Sink {
+	notifiers := []alert.Notifier{alert.NotifierFunc(func(events []alert.Event) error {
+		for _, ev := range events {
+			attrs := []any{"host", ev.Host, "rule", ev.Rule, "values", ev.Values, "since", ev.Since}
+			if ev.State == alert.Resolved {
+				log.Info("alert resolved", attrs...)
+			} else {
+				log.Warn("alert firing", attrs...)
+			}
+		}
+		return nil
+	})}
+	if flags.AlertWebhook != "" {
+		notifiers = append(notifiers, alert.NewWebhook(flags.AlertWebhook, alert.WebhookOptions{}))
+	}
+	report := func(err error) { log.Error("alert delivery failed", "err", err) }
+	return alert.NewSink(flags.Alerts, report, notifiers...)
+}
+
+// closeSink closes s, giving up after timeout like FanOut.Close does
+func closeSink(name string, s sink.Sink, timeout time.Duration, log *slog.Logger) {
+	done := make(chan error, 1)
+	go func() { done <- s.Close() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Error("sink close failed", "sink", name, "err", err)
+		}
+	case <-time.After(timeout):
+		log.Error("sink did not finish, giving up", "sink", name, "timeout", timeout)
+	}
+}
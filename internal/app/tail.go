@@ -1,23 +1,94 @@
 package app
 
 import (
+	"accessAggregator/internal/clock"
 	"accessAggregator/internal/tailer"
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"time"
 )
 
-func tail(ctx context.Context, fpath string, fromStart bool, data chan<- []byte) error {
-	tf, err := tailer.NewTailFile(fpath, tailer.OsFS{}, fromStart)
-	if err != nil {
-		return err
+const pollInterval = 100 * time.Millisecond
+
+// tail opens in and streams it, retrying the open with backoff when retry is
+// set, and replaying it up to its current end when rp is set.
+func tail(ctx context.Context, clk clock.Clock, in Input, log *slog.Logger, retry *tailer.Retry, rp *replay, data chan<- []byte, out *sender) error {
+	var tf tailer.Tailer
+	for attempt := 0; ; attempt++ {
+		var err error
+		if tf, err = in.Open(log); err == nil {
+			break
+		}
+		if retry == nil {
+			return err
+		}
+		out.stats.setState(inputWaiting)
+		delay := retry.Delay(attempt)
+		if attempt == 0 {
+			log.Warn("open failed, waiting for file", "err", err, "retry_in", delay)
+		} else {
+			log.Debug("open failed", "err", err, "attempt", attempt+1, "retry_in", delay)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-clk.After(delay):
+		}
+	}
+	if bc, ok := tf.(byteCounter); ok {
+		out.throttle.countBytes(bc)
+	}
+	if rp != nil {
+		tf = exhaustAtEOF{tf}
 	}
-	return streamLoop(tf, ctx, data)
+	if in.Framing.Framing != tailer.FrameLines {
+		framing := in.Framing
+		framing.Clock = clk
+		tf = tailer.NewFramer(tf, framing)
+	}
+	if rp != nil {
+		tf = rp.pace(tf)
+	}
+	out.stats.setState(inputTailing)
+	return streamLoop(tf, ctx, clk, data, out)
+}
+
+// oversizeCounter reports lines a tailer skipped for their length
+type oversizeCounter interface {
+	Oversize() int64
+}
+
+// byteCounter reports every byte a tailer consumed, the lines it skipped
+// included
+type byteCounter interface {
+	BytesRead() int64
+}
+
+// pendingFlusher hands over a record held back for the lines that may
+// still complete it
+type pendingFlusher interface {
+	Flush() []byte
+}
+
+// retryingTailer reports a file that is gone or failing to reopen while the
+// tailer keeps retrying
+type retryingTailer interface {
+	Err() error
 }
 
-func streamLoop(tf tailer.Tailer, ctx context.Context, data chan<- []byte) error {
+func streamLoop(tf tailer.Tailer, ctx context.Context, clk clock.Clock, data chan<- []byte, out *sender) error {
 	defer tf.Close()
+	// a multiline record still pending when the stream stops is sent as is
+	defer func() {
+		if f, ok := tf.(pendingFlusher); ok {
+			if rawRecord := f.Flush(); len(rawRecord) > 0 {
+				out.send(data, rawRecord)
+			}
+		}
+	}()
+	oc, countsOversize := tf.(oversizeCounter)
 
 	for {
 		select {
@@ -25,18 +96,35 @@ func streamLoop(tf tailer.Tailer, ctx context.Context, data chan<- []byte) error
 			return nil
 		default:
 			rawRecord, err := tf.GetRawRecord()
+			if countsOversize {
+				out.stats.oversize.Store(oc.Oversize())
+			}
 			if err == io.EOF {
+				out.throttle.caughtUp()
+				if r, ok := tf.(retryingTailer); ok {
+					if r.Err() != nil {
+						out.stats.setState(inputErrored)
+					} else {
+						out.stats.setState(inputTailing)
+					}
+				}
 				select {
 				case <-ctx.Done():
 					return nil
-				case <-time.After(100 * time.Millisecond):
+				case <-clk.After(pollInterval):
 					continue
 				}
 			}
+			if err == tailer.ErrExhausted {
+				return nil
+			}
 			if err != nil {
 				return fmt.Errorf("reading record: %w", err)
 			}
-			data <- rawRecord
+			if !out.throttle.wait(ctx, len(rawRecord)) {
+				return nil
+			}
+			out.send(data, rawRecord)
 		}
 	}
 
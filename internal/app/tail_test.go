@@ -1,9 +1,15 @@
 package app
 
 import (
+	"accessAggregator/internal/clock"
+	"accessAggregator/internal/config"
+	"accessAggregator/internal/tailer"
 	"context"
 	"errors"
 	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -96,6 +102,18 @@ func TestRunStreamLoop(t *testing.T) {
 			rawCap:    1,
 			expectErr: "reading record: boom",
 		},
+		{
+			name: "exhausted source ends the loop",
+			mock: &mockTailer{
+				records: [][]byte{[]byte("only")},
+				errs:    []error{tailer.ErrExhausted},
+			},
+			ctxSetup: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			rawCap:     1,
+			expectRecs: [][]byte{[]byte("only")},
+		},
 		{
 			name: "context canceled while sending",
 			mock: &mockTailer{
@@ -121,7 +139,7 @@ func TestRunStreamLoop(t *testing.T) {
 
 			done := make(chan error, 1)
 			go func() {
-				done <- streamLoop(tt.mock, ctx, rawRecords)
+				done <- streamLoop(tt.mock, ctx, clock.Real{}, rawRecords, newSender(config.Flags{}, clock.Real{}, &inputStats{}))
 			}()
 
 			if tt.cancelAfter > 0 {
@@ -156,3 +174,131 @@ func TestRunStreamLoop(t *testing.T) {
 		})
 	}
 }
+
+func TestStreamLoop_PollsOnClock(t *testing.T) {
+	mock := &mockTailer{errs: []error{io.EOF}}
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	data := make(chan []byte, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- streamLoop(mock, ctx, clk, data, newSender(config.Flags{}, clk, &inputStats{}))
+	}()
+
+	// waiting on the poll timer after EOF
+	clk.BlockUntil(1)
+	if calls := mock.calls; calls != 1 {
+		t.Fatalf("expected 1 read before polling, got %d", calls)
+	}
+
+	clk.Advance(pollInterval)
+	clk.BlockUntil(1) // next EOF, polling again
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if mock.calls != 2 {
+		t.Errorf("expected exactly one more read after one poll interval, got %d reads", mock.calls)
+	}
+}
+
+func TestStreamLoop_FlushesPendingOnCancel(t *testing.T) {
+	mock := &mockTailer{records: [][]byte{[]byte("{\n"), []byte(`"host": "a.com",` + "\n")}}
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+	f := tailer.NewFramer(mock, tailer.FramerOptions{Framing: tailer.FrameJSON, Clock: clk})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	data := make(chan []byte, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- streamLoop(f, ctx, clk, data, newSender(config.Flags{}, clk, &inputStats{}))
+	}()
+
+	// both lines read, the record waits for its closing brace
+	clk.BlockUntil(1)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case rec := <-data:
+		if want := "{\n\"host\": \"a.com\",\n"; string(rec) != want {
+			t.Errorf("sent %q, want %q", rec, want)
+		}
+	default:
+		t.Error("pending record lost on cancel")
+	}
+}
+
+func TestTail_WaitsForMissingFile(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+	opens := 0
+	in := Input{Name: "late.log", Open: func(*slog.Logger) (tailer.Tailer, error) {
+		opens++
+		if opens < 3 {
+			return nil, os.ErrNotExist
+		}
+		return &mockTailer{records: [][]byte{[]byte("hello")}, errs: []error{tailer.ErrExhausted}}, nil
+	}}
+
+	stats := &inputStats{}
+	data := make(chan []byte, 1)
+	done := make(chan error, 1)
+	go func() {
+		retry := &tailer.Retry{Initial: time.Second, Max: time.Minute}
+		done <- tail(context.Background(), clk, in, slog.New(slog.DiscardHandler), retry, nil, data, newSender(config.Flags{}, clk, stats))
+	}()
+
+	clk.BlockUntil(1)
+	if s := stats.getState(); s != inputWaiting {
+		t.Fatalf("state = %v, want waiting", s)
+	}
+	clk.Advance(time.Second)
+	clk.BlockUntil(1)
+	clk.Advance(2 * time.Second) // doubled
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := <-data; string(got) != "hello" {
+		t.Errorf("record = %q, want hello", got)
+	}
+	if opens != 3 {
+		t.Errorf("expected 3 opens, got %d", opens)
+	}
+}
+
+func TestTail_FailsWithoutRetry(t *testing.T) {
+	in := Input{Name: "missing.log", Open: func(*slog.Logger) (tailer.Tailer, error) {
+		return nil, os.ErrNotExist
+	}}
+	err := tail(context.Background(), clock.Real{}, in, slog.New(slog.DiscardHandler), nil, nil, nil, newSender(config.Flags{}, clock.Real{}, &inputStats{}))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("tail() error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestFileOpener_LateFileFromBeginning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "late.log")
+	open := FileOpener(path, func() tailer.Options { return tailer.Options{} })
+	log := slog.New(slog.DiscardHandler)
+
+	if _, err := open(log); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("open() error = %v, want ErrNotExist", err)
+	}
+	if err := os.WriteFile(path, []byte("written before the retry\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := open(log)
+	if err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	defer tf.Close()
+	if got, err := tf.GetRawRecord(); err != nil || string(got) != "written before the retry\n" {
+		t.Errorf("GetRawRecord() = %q, %v, want the line written before the open", got, err)
+	}
+}
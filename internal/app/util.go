@@ -1,9 +1,45 @@
 package app
 
+import (
+	"accessAggregator/internal/config"
+	"accessAggregator/internal/term"
+	"io"
+	"os"
+)
+
 const (
-	reset = "\033[0m"
-	red   = "\033[31m"
-	green = "\033[32m"
+	reset  = "\033[0m"
+	red    = "\033[31m"
+	green  = "\033[32m"
 	yellow = "\033[33m"
 )
 
+var isTerminal = term.IsTerminal
+
+// palette colors messages for one writer, or leaves them plain
+type palette struct {
+	enabled bool
+}
+
+// newPalette decides color for w: always and never win, otherwise color is
+// used when w is a terminal and NO_COLOR is unset or empty.
+func newPalette(mode config.ColorMode, w io.Writer) palette {
+	switch mode {
+	case config.ColorAlways:
+		return palette{enabled: true}
+	case config.ColorNever:
+		return palette{}
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return palette{}
+	}
+	f, ok := w.(*os.File)
+	return palette{enabled: ok && isTerminal(f.Fd())}
+}
+
+func (p palette) paint(color, s string) string {
+	if !p.enabled {
+		return s
+	}
+	return color + s + reset
+}
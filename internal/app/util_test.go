@@ -0,0 +1,45 @@
+package app
+
+import (
+	"accessAggregator/internal/config"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestPalette(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	tests := []struct {
+		name    string
+		mode    config.ColorMode
+		noColor string
+		w       io.Writer
+		tty     bool
+		want    string
+	}{
+		{"auto on a buffer", config.ColorAuto, "", &bytes.Buffer{}, false, "hi"},
+		{"auto on a non-terminal file", config.ColorAuto, "", devNull, false, "hi"},
+		{"auto on a terminal", config.ColorAuto, "", devNull, true, red + "hi" + reset},
+		{"auto on a terminal with NO_COLOR", config.ColorAuto, "1", devNull, true, "hi"},
+		{"always on a buffer", config.ColorAlways, "", &bytes.Buffer{}, false, red + "hi" + reset},
+		{"always beats NO_COLOR", config.ColorAlways, "1", &bytes.Buffer{}, false, red + "hi" + reset},
+		{"never", config.ColorNever, "", devNull, true, "hi"},
+	}
+	originalIsTerminal := isTerminal
+	defer func() { isTerminal = originalIsTerminal }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NO_COLOR", tt.noColor)
+			isTerminal = func(uintptr) bool { return tt.tty }
+			if got := newPalette(tt.mode, tt.w).paint(red, "hi"); got != tt.want {
+				t.Errorf("paint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
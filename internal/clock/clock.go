@@ -0,0 +1,204 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the subset of package time the agent depends on, so tests can
+// drive time by hand. Public as aggregator.Clock, changes must keep its
+// compatibility promise.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real implements Clock with package time.
+type Real struct{}
+
+func (Real) Now() time.Time                         { return time.Now() }
+func (Real) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (Real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (Real) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// Fake is a Clock that only moves on Advance. Like time.Ticker, a fake
+// ticker drops ticks while its channel is full. Public as
+// aggregator.FakeClock, changes must keep its compatibility promise.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+	changed chan struct{} // closed and replaced whenever waiters change
+}
+
+type waiter struct {
+	next   time.Time
+	period time.Duration // 0 for one shot timers
+	ch     chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now, changed: make(chan struct{})}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &waiter{next: f.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- f.now
+		return w.ch
+	}
+	f.addLocked(w)
+	return w.ch
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &waiter{next: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.addLocked(w)
+	return &fakeTicker{f: f, w: w}
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker that
+// falls due on the way in deadline order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := f.now.Add(d)
+	for {
+		var due *waiter
+		for _, w := range f.waiters {
+			if !w.next.After(end) && (due == nil || w.next.Before(due.next)) {
+				due = w
+			}
+		}
+		if due == nil {
+			break
+		}
+
+		f.now = due.next
+		select {
+		case due.ch <- f.now:
+		default:
+		}
+		if due.period > 0 {
+			due.next = due.next.Add(due.period)
+		} else {
+			f.removeLocked(due)
+		}
+	}
+	f.now = end
+}
+
+// Rebase moves the clock to t without firing anything, shifting every
+// pending deadline along, as if the clock had been started at t.
+func (f *Fake) Rebase(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// offsets from now, t may be further from now than a Duration holds
+	for _, w := range f.waiters {
+		w.next = t.Add(w.next.Sub(f.now))
+	}
+	f.now = t
+}
+
+// Next is the earliest deadline of a pending timer or ticker.
+func (f *Fake) Next() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var next time.Time
+	for _, w := range f.waiters {
+		if next.IsZero() || w.next.Before(next) {
+			next = w.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Delivered reports whether every value fired into a pending ticker or
+// timer channel has been received.
+func (f *Fake) Delivered() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, w := range f.waiters {
+		if len(w.ch) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// BlockUntil waits until at least n timers or tickers are pending, so a test
+// knows the code under test is waiting on the clock before advancing it.
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		pending, changed := len(f.waiters), f.changed
+		f.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+func (f *Fake) addLocked(w *waiter) {
+	f.waiters = append(f.waiters, w)
+	f.notifyLocked()
+}
+
+func (f *Fake) removeLocked(w *waiter) {
+	for i, o := range f.waiters {
+		if o == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.notifyLocked()
+			return
+		}
+	}
+}
+
+func (f *Fake) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+
+func (t *fakeTicker) Stop() {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	t.f.removeLocked(t.w)
+}
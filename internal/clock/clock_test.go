@@ -0,0 +1,125 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+
+func TestFake_Ticker(t *testing.T) {
+	f := NewFake(epoch)
+	tk := f.NewTicker(10 * time.Second)
+	defer tk.Stop()
+
+	f.Advance(9 * time.Second)
+	select {
+	case got := <-tk.C():
+		t.Fatalf("ticker fired early at %v", got)
+	default:
+	}
+
+	f.Advance(time.Second)
+	if got := <-tk.C(); !got.Equal(epoch.Add(10 * time.Second)) {
+		t.Errorf("tick = %v, want %v", got, epoch.Add(10*time.Second))
+	}
+
+	// ticks are dropped while nobody reads, like time.Ticker
+	f.Advance(35 * time.Second)
+	if got := <-tk.C(); !got.Equal(epoch.Add(20 * time.Second)) {
+		t.Errorf("tick = %v, want first undelivered tick %v", got, epoch.Add(20*time.Second))
+	}
+	select {
+	case got := <-tk.C():
+		t.Fatalf("unexpected buffered tick %v", got)
+	default:
+	}
+	if !f.Now().Equal(epoch.Add(45 * time.Second)) {
+		t.Errorf("Now() = %v, want %v", f.Now(), epoch.Add(45*time.Second))
+	}
+}
+
+func TestFake_After(t *testing.T) {
+	f := NewFake(epoch)
+	ch := f.After(100 * time.Millisecond)
+
+	f.Advance(50 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("After fired early")
+	default:
+	}
+
+	f.Advance(50 * time.Millisecond)
+	select {
+	case got := <-ch:
+		if !got.Equal(epoch.Add(100 * time.Millisecond)) {
+			t.Errorf("After delivered %v", got)
+		}
+	default:
+		t.Fatal("After did not fire")
+	}
+	if f.Since(epoch) != 100*time.Millisecond {
+		t.Errorf("Since() = %v", f.Since(epoch))
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		f.BlockUntil(2)
+		close(done)
+	}()
+
+	f.After(time.Second)
+	select {
+	case <-done:
+		t.Fatal("BlockUntil returned with one waiter")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	tk := f.NewTicker(time.Second)
+	defer tk.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("BlockUntil did not return with two waiters")
+	}
+}
+
+func TestFake_NextAndDelivered(t *testing.T) {
+	f := NewFake(epoch)
+	if _, ok := f.Next(); ok {
+		t.Error("Next() without timers should report none")
+	}
+	tk := f.NewTicker(10 * time.Second)
+	defer tk.Stop()
+	f.After(5 * time.Second)
+
+	if next, ok := f.Next(); !ok || !next.Equal(epoch.Add(5*time.Second)) {
+		t.Errorf("Next() = %v, %v, want the timer at 5s", next, ok)
+	}
+
+	later := epoch.Add(time.Hour)
+	f.Rebase(later)
+	if next, _ := f.Next(); !f.Now().Equal(later) || !next.Equal(later.Add(5*time.Second)) {
+		t.Errorf("after Rebase Now() = %v, Next() = %v, want deadlines moved along", f.Now(), next)
+	}
+	f.Advance(10 * time.Second)
+	if f.Delivered() {
+		t.Error("Delivered() = true with an unread tick")
+	}
+	<-tk.C()
+	if !f.Delivered() {
+		t.Error("Delivered() = false after reading the tick")
+	}
+
+	// further from the zero time than a Duration reaches
+	z := NewFake(time.Time{})
+	z.NewTicker(time.Second)
+	z.Rebase(epoch)
+	if next, _ := z.Next(); !next.Equal(epoch.Add(time.Second)) {
+		t.Errorf("Rebase from the zero time: Next() = %v, want %v", next, epoch.Add(time.Second))
+	}
+}
@@ -1,19 +1,233 @@
 package config
 
 import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/alert"
+	"accessAggregator/internal/sink"
+	"accessAggregator/internal/tailer"
 	"flag"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Flags struct {
 	Files     []string
 	FromStart bool
+	Start     tailer.StartPosition // overrides FromStart when set
 	Interval  time.Duration
+	TUI       bool
+	Color     ColorMode
+
+	// retry missing or failing files with Retry instead of giving up
+	WaitForFiles bool
+	Retry        tailer.Retry
+	// by path, only for files given -file-options
+	FileOptions map[string]FileOptions
+	MaxLineSize int // 0 for no limit
+
+	// read limits per input, overridable per file, and over all inputs, 0
+	// for none
+	RateLines, RateBytes             float64
+	GlobalRateLines, GlobalRateBytes float64
+	// limits only apply until an input first reaches its end
+	CatchUp bool
+
+	// read files once, paced by record times, with ticks on record time
+	Replay      bool
+	ReplaySpeed float64 // 0 for as fast as possible
+
+	LogLevel  slog.Level
+	LogFormat LogFormat
+
+	DistinctField     string
+	DistinctPrecision uint
+
+	MaxGroups int
+	Overflow  accesslog.OverflowPolicy
+
+	Workers int
+
+	Backpressure Backpressure
+	SampleRate   int
+	BufferSize   int // 0 picks a size from the number of files
+
+	Sinks []sink.Spec
+
+	Alerts       []alert.Rule
+	AlertWebhook string
+
+	SLOs []accesslog.SLO
+
+	AnomalySigma float64 // 0 disables anomaly detection
+	AnomalyAlpha float64
+
+	// order, limit and columns of the table and the sinks
+	View accesslog.View
+}
+
+// ColorMode decides whether messages are colored with ANSI escapes.
+type ColorMode int
+
+const (
+	// color terminals unless NO_COLOR is set
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+func ParseColorMode(s string) (ColorMode, error) {
+	switch s {
+	case "auto":
+		return ColorAuto, nil
+	case "always":
+		return ColorAlways, nil
+	case "never":
+		return ColorNever, nil
+	}
+	return 0, fmt.Errorf("unknown color mode %q: want auto, always or never", s)
+}
+
+// FileOptions are the settings of one -file, given with -file-options as
+// path?key=value&... in URL query syntax. start, a regular expression, is
+// the exception: it must come last and is taken verbatim, so +, ? and & in
+// it need no escaping.
+type FileOptions struct {
+	Identity        tailer.Identity
+	FingerprintSize int
+
+	Framing      tailer.Framing
+	Start        *regexp.Regexp
+	FlushTimeout time.Duration
+
+	// override Flags.RateLines and RateBytes when set
+	RateLines, RateBytes float64
+}
+
+func ParseFileOptions(s string) (string, FileOptions, error) {
+	// start is cut off before the query is decoded, keeping the ? or &
+	// in front of it
+	var start string
+	hasStart := false
+	for _, key := range []string{"?start=", "&start="} {
+		if i := strings.Index(s, key); i > 0 {
+			s, start, hasStart = s[:i+1], s[i+len(key):], true
+			break
+		}
+	}
+
+	i := strings.LastIndex(s, "?")
+	if i <= 0 {
+		return "", FileOptions{}, fmt.Errorf("invalid file options %q: want path?key=value", s)
+	}
+	path := s[:i]
+	params, err := url.ParseQuery(s[i+1:])
+	if err != nil {
+		return "", FileOptions{}, fmt.Errorf("invalid file options %q: %w", s, err)
+	}
+
+	var opts FileOptions
+	for key, values := range params {
+		v := values[len(values)-1]
+		switch key {
+		case "identity":
+			opts.Identity, err = tailer.ParseIdentity(v)
+		case "fingerprint_bytes":
+			opts.FingerprintSize, err = strconv.Atoi(v)
+			if err == nil && opts.FingerprintSize < 1 {
+				err = fmt.Errorf("fingerprint_bytes must be positive, got %d", opts.FingerprintSize)
+			}
+		case "framing":
+			opts.Framing, err = tailer.ParseFraming(v)
+		case "flush":
+			opts.FlushTimeout, err = time.ParseDuration(v)
+			if err == nil && opts.FlushTimeout <= 0 {
+				err = fmt.Errorf("flush must be positive, got %v", opts.FlushTimeout)
+			}
+		case "rate_lines":
+			opts.RateLines, err = parseRate(v)
+		case "rate_bytes":
+			opts.RateBytes, err = parseRate(v)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return "", FileOptions{}, fmt.Errorf("invalid file options for %s: %w", path, err)
+		}
+	}
+	if hasStart {
+		if opts.Start, err = regexp.Compile(start); err != nil {
+			return "", FileOptions{}, fmt.Errorf("invalid file options for %s: %w", path, err)
+		}
+	}
+	if (opts.Framing == tailer.FramePattern) != (opts.Start != nil) {
+		return "", FileOptions{}, fmt.Errorf("invalid file options for %s: start goes with framing=pattern", path)
+	}
+	return path, opts, nil
+}
+
+func parseRate(s string) (float64, error) {
+	rate, err := strconv.ParseFloat(s, 64)
+	if err == nil && rate < 0 {
+		err = fmt.Errorf("rate must not be negative, got %v", rate)
+	}
+	return rate, err
+}
+
+// LogFormat picks the slog handler for diagnostics on stderr.
+type LogFormat int
+
+const (
+	LogText LogFormat = iota
+	LogJSON
+)
+
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch s {
+	case "text":
+		return LogText, nil
+	case "json":
+		return LogJSON, nil
+	}
+	return 0, fmt.Errorf("unknown log format %q: want text or json", s)
+}
+
+// Backpressure decides what a tailer does when the aggregator falls behind
+// and the shared channel is full.
+type Backpressure int
+
+const (
+	// wait for room, nothing is lost
+	BackpressureBlock Backpressure = iota
+	// drop the line that does not fit
+	BackpressureDrop
+	// keep one in SampleRate lines while full, drop the others
+	BackpressureSample
+)
+
+func ParseBackpressure(s string) (Backpressure, error) {
+	switch s {
+	case "block":
+		return BackpressureBlock, nil
+	case "drop":
+		return BackpressureDrop, nil
+	case "sample":
+		return BackpressureSample, nil
+	}
+	return 0, fmt.Errorf("unknown backpressure policy %q: want block, drop or sample", s)
 }
 
-const defaultInterval = 10
+const (
+	defaultInterval          = 10
+	defaultDistinctPrecision = 12
+	defaultSampleRate        = 10
+	defaultAnomalyAlpha      = 0.3
+)
 
 func ParseFlags() (Flags, error) {
 	var flags Flags
@@ -28,8 +242,110 @@ func ParseFlags() (Flags, error) {
 		return nil
 	})
 
+	flag.Func("file-options", "settings of one -file as path?key=value&..., keys: identity=inode|fingerprint, fingerprint_bytes=N, framing=lines|json|pattern, flush=DURATION, rate_lines=N, rate_bytes=N, and last start=REGEXP, taken verbatim", func(s string) error {
+		path, opts, err := ParseFileOptions(s)
+		if err != nil {
+			return err
+		}
+		if flags.FileOptions == nil {
+			flags.FileOptions = map[string]FileOptions{}
+		}
+		flags.FileOptions[path] = opts
+		return nil
+	})
+
 	flag.BoolVar(&flags.FromStart, "from-start", false, "read from beginning")
+	flag.Func("start", "where to start reading each file: end, beginning, offset:BYTES, lines:N or time:RFC3339 (default end, or beginning with -from-start)", func(s string) error {
+		p, err := tailer.ParseStartPosition(s)
+		flags.Start = p
+		return err
+	})
+	flag.Float64Var(&flags.RateLines, "rate-lines", 0, "most lines per second read from each file, 0 for no limit")
+	flag.Float64Var(&flags.RateBytes, "rate-bytes", 0, "most bytes per second read from each file, 0 for no limit")
+	flag.Float64Var(&flags.GlobalRateLines, "global-rate-lines", 0, "most lines per second read from all files together, 0 for no limit")
+	flag.Float64Var(&flags.GlobalRateBytes, "global-rate-bytes", 0, "most bytes per second read from all files together, 0 for no limit")
+	flag.BoolVar(&flags.Replay, "replay", false, "replay a single file from the beginning (or -start) to its current end, paced by record times, with summaries on record time as if live")
+	flag.Float64Var(&flags.ReplaySpeed, "replay-speed", 1, "replay speed multiplier, e.g. 10 or 100, 0 for as fast as possible")
+	flag.BoolVar(&flags.CatchUp, "catch-up", false, "apply rate limits only until a file is read up to its end, e.g. for -from-start backlogs")
+	flag.IntVar(&flags.MaxLineSize, "max-line-bytes", 1<<20, "skip and count lines, and multiline records, longer than this, 0 for no limit")
 	flag.DurationVar(&flags.Interval, "interval", defaultInterval*time.Second, "summary interval")
+	flag.Func("color", "ANSI colors: auto, always or never (default auto, off when NO_COLOR is set or output is not a terminal)", func(s string) error {
+		m, err := ParseColorMode(s)
+		flags.Color = m
+		return err
+	})
+	flag.Func("log-level", "lowest level of diagnostics written to stderr: debug, info, warn or error (default info)", func(s string) error {
+		return flags.LogLevel.UnmarshalText([]byte(s))
+	})
+	flag.Func("log-format", "format of diagnostics written to stderr: text or json (default text)", func(s string) error {
+		f, err := ParseLogFormat(s)
+		flags.LogFormat = f
+		return err
+	})
+	flag.BoolVar(&flags.WaitForFiles, "wait-for-files", false, "wait for files that are missing at startup, reading them from the beginning once they appear, and keep retrying files that disappear or fail to reopen")
+	flag.DurationVar(&flags.Retry.Initial, "retry-initial", 500*time.Millisecond, "first retry delay with -wait-for-files, doubled on every failure")
+	flag.DurationVar(&flags.Retry.Max, "retry-max", 30*time.Second, "longest retry delay with -wait-for-files")
+	flag.BoolVar(&flags.TUI, "tui", false, "interactive dashboard redrawn in place, plain table when stdout is not a terminal")
+	flag.StringVar(&flags.DistinctField, "distinct-field", "", "record field to count unique values of per host, e.g. client_ip")
+	flag.IntVar(&flags.Workers, "workers", 1, "parse and aggregate on this many goroutines, sharded by host")
+	flag.IntVar(&flags.MaxGroups, "max-groups", 0, "maximum number of hosts tracked, 0 for unlimited, approximate with -workers as it is split across them")
+	flag.Func("overflow", "what to do with new hosts past -max-groups: other or evict (default other)", func(s string) error {
+		p, err := accesslog.ParseOverflowPolicy(s)
+		flags.Overflow = p
+		return err
+	})
+	flag.Func("backpressure", "when the aggregator falls behind: block, drop or sample (default block)", func(s string) error {
+		p, err := ParseBackpressure(s)
+		flags.Backpressure = p
+		return err
+	})
+	flag.IntVar(&flags.SampleRate, "sample-rate", defaultSampleRate, "with -backpressure=sample, keep one in this many lines while full")
+	flag.IntVar(&flags.BufferSize, "buffer", 0, "shared channel size, 0 to scale with the number of files")
+	flag.Func("sink", "extra output as kind=target?params, repeatable, kinds json, statsd, dogstatsd, graphite, influx, e.g. dogstatsd=127.0.0.1:8125?tag=env:prod", func(s string) error {
+		spec, err := sink.ParseSpec(s)
+		if err != nil {
+			return err
+		}
+		for _, seen := range flags.Sinks {
+			if seen.String() == spec.String() {
+				return fmt.Errorf("duplicate sink: %s", spec)
+			}
+		}
+		flags.Sinks = append(flags.Sinks, spec)
+		return nil
+	})
+	flag.Func("alert", "alert rule, repeatable, e.g. 'host=~`api\\..*` and error_ratio > 0.05 for 3 ticks', backquoted strings are taken verbatim, double quoted ones take Go escapes", func(s string) error {
+		rule, err := alert.ParseRule(s)
+		if err != nil {
+			return err
+		}
+		flags.Alerts = append(flags.Alerts, rule)
+		return nil
+	})
+	flag.StringVar(&flags.AlertWebhook, "alert-webhook", "", "URL that firing and resolved alerts are POSTed to as JSON")
+	flag.Func("slo", `availability objective, repeatable, e.g. 'name=api hosts=api\..* target=99.9 latency=300ms window=30d'`, func(s string) error {
+		slo, err := accesslog.ParseSLO(s)
+		if err != nil {
+			return err
+		}
+		flags.SLOs = append(flags.SLOs, slo)
+		return nil
+	})
+	flag.Float64Var(&flags.AnomalySigma, "anomaly-sigma", 0, "flag hosts whose rate, error ratio or avg duration deviates this many standard deviations from its EWMA baseline, 0 to disable")
+	flag.Float64Var(&flags.AnomalyAlpha, "anomaly-alpha", defaultAnomalyAlpha, "EWMA weight of the newest tick for -anomaly-sigma (0-1]")
+	flag.Func("sort", "order hosts by host, total, errors, error_ratio or avg_duration (default host)", func(s string) error {
+		k, err := accesslog.ParseSortKey(s)
+		flags.View.Sort = k
+		return err
+	})
+	order := flag.String("order", "", "asc or desc, defaults to asc for -sort host and desc otherwise")
+	flag.IntVar(&flags.View.Top, "top", 0, "show the first N hosts and sum the rest into an "+accesslog.OthersRow+" row, 0 for all")
+	flag.Func("columns", "comma separated table columns out of total, 2xx, non_2xx, avg_duration, 5xx, error_ratio, uniq", func(s string) error {
+		cols, err := accesslog.ParseColumns(s)
+		flags.View.Columns = cols
+		return err
+	})
+	flag.UintVar(&flags.DistinctPrecision, "distinct-precision", defaultDistinctPrecision, "HyperLogLog precision for -distinct-field (4-16)")
 
 	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
 		return Flags{}, err
@@ -39,5 +355,87 @@ func ParseFlags() (Flags, error) {
 		return Flags{}, fmt.Errorf("missing required flag: at least one -file must be provided")
 	}
 
+	if flags.FromStart && flags.Start.Kind != tailer.StartDefault {
+		return Flags{}, fmt.Errorf("-from-start and -start are mutually exclusive")
+	}
+
+	for path := range flags.FileOptions {
+		if !seen[path] {
+			return Flags{}, fmt.Errorf("-file-options for %s, which is not a -file", path)
+		}
+	}
+
+	for name, rate := range map[string]float64{
+		"rate-lines": flags.RateLines, "rate-bytes": flags.RateBytes,
+		"global-rate-lines": flags.GlobalRateLines, "global-rate-bytes": flags.GlobalRateBytes,
+	} {
+		if rate < 0 {
+			return Flags{}, fmt.Errorf("invalid -%s %v: must not be negative", name, rate)
+		}
+	}
+
+	if flags.ReplaySpeed < 0 {
+		return Flags{}, fmt.Errorf("invalid -replay-speed %v: must not be negative", flags.ReplaySpeed)
+	}
+	if flags.Replay && len(flags.Files) > 1 {
+		return Flags{}, fmt.Errorf("-replay takes a single -file")
+	}
+
+	if flags.MaxLineSize < 0 {
+		return Flags{}, fmt.Errorf("invalid -max-line-bytes %d: must not be negative", flags.MaxLineSize)
+	}
+
+	if flags.DistinctPrecision < 4 || flags.DistinctPrecision > 16 {
+		return Flags{}, fmt.Errorf("invalid -distinct-precision %d: must be between 4 and 16", flags.DistinctPrecision)
+	}
+
+	if flags.Workers < 1 {
+		return Flags{}, fmt.Errorf("invalid -workers %d: must be at least 1", flags.Workers)
+	}
+
+	if flags.SampleRate < 1 {
+		return Flags{}, fmt.Errorf("invalid -sample-rate %d: must be at least 1", flags.SampleRate)
+	}
+
+	if flags.BufferSize < 0 {
+		return Flags{}, fmt.Errorf("invalid -buffer %d: must not be negative", flags.BufferSize)
+	}
+
+	if flags.MaxGroups < 0 {
+		return Flags{}, fmt.Errorf("invalid -max-groups %d: must not be negative", flags.MaxGroups)
+	}
+	if flags.MaxGroups > 0 && flags.MaxGroups < flags.Workers {
+		return Flags{}, fmt.Errorf("invalid -max-groups %d: must be at least -workers %d", flags.MaxGroups, flags.Workers)
+	}
+
+	switch *order {
+	case "":
+		flags.View.Desc = flags.View.Sort != accesslog.SortHost
+	case "asc", "desc":
+		flags.View.Desc = *order == "desc"
+	default:
+		return Flags{}, fmt.Errorf("invalid -order %q: want asc or desc", *order)
+	}
+
+	if flags.Retry.Initial <= 0 || flags.Retry.Max < flags.Retry.Initial {
+		return Flags{}, fmt.Errorf("invalid -retry-initial %v and -retry-max %v: need 0 < initial <= max", flags.Retry.Initial, flags.Retry.Max)
+	}
+
+	if flags.View.Top < 0 {
+		return Flags{}, fmt.Errorf("invalid -top %d: must not be negative", flags.View.Top)
+	}
+
+	if flags.AnomalySigma < 0 {
+		return Flags{}, fmt.Errorf("invalid -anomaly-sigma %v: must not be negative", flags.AnomalySigma)
+	}
+
+	if flags.AnomalyAlpha <= 0 || flags.AnomalyAlpha > 1 {
+		return Flags{}, fmt.Errorf("invalid -anomaly-alpha %v: must be in (0, 1]", flags.AnomalyAlpha)
+	}
+
+	if flags.AlertWebhook != "" && len(flags.Alerts) == 0 {
+		return Flags{}, fmt.Errorf("-alert-webhook needs at least one -alert")
+	}
+
 	return flags, nil
 }
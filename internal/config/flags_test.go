@@ -1,6 +1,7 @@
 package config
 
 import (
+	"accessAggregator/internal/tailer"
 	"flag"
 	"io"
 	"os"
@@ -17,6 +18,7 @@ func TestParseFlags(t *testing.T) {
 		wantFiles     []string
 		wantFromStart bool
 		wantInterval  time.Duration
+		wantDistinct  string
 		wantError     string
 	}{
 		{
@@ -47,6 +49,159 @@ func TestParseFlags(t *testing.T) {
 			wantFromStart: false,
 			wantInterval:  5 * time.Second,
 		},
+		{
+			name:          "distinct field",
+			args:          []string{"-file", "app.log", "-distinct-field", "client_ip"},
+			wantFiles:     []string{"app.log"},
+			wantFromStart: false,
+			wantInterval:  10 * time.Second,
+			wantDistinct:  "client_ip",
+		},
+		{
+			name:      "distinct precision out of range",
+			args:      []string{"-file", "app.log", "-distinct-precision", "20"},
+			wantError: "invalid -distinct-precision 20",
+		},
+		{
+			name:      "unknown overflow policy",
+			args:      []string{"-file", "app.log", "-max-groups", "10", "-overflow", "drop"},
+			wantError: "unknown overflow policy",
+		},
+		{
+			name:      "negative max groups",
+			args:      []string{"-file", "app.log", "-max-groups", "-1"},
+			wantError: "invalid -max-groups -1",
+		},
+		{
+			name:      "max groups below workers",
+			args:      []string{"-file", "app.log", "-max-groups", "2", "-workers", "4"},
+			wantError: "must be at least -workers 4",
+		},
+		{
+			name:      "zero workers",
+			args:      []string{"-file", "app.log", "-workers", "0"},
+			wantError: "invalid -workers 0",
+		},
+		{
+			name:      "unknown backpressure policy",
+			args:      []string{"-file", "app.log", "-backpressure", "panic"},
+			wantError: "unknown backpressure policy",
+		},
+		{
+			name:      "zero sample rate",
+			args:      []string{"-file", "app.log", "-backpressure", "sample", "-sample-rate", "0"},
+			wantError: "invalid -sample-rate 0",
+		},
+		{
+			name:      "invalid sink",
+			args:      []string{"-file", "app.log", "-sink", "json"},
+			wantError: "want kind=target",
+		},
+		{
+			name:      "duplicate sink",
+			args:      []string{"-file", "app.log", "-sink", "json=out.jsonl", "-sink", "json=out.jsonl"},
+			wantError: "duplicate sink: json=out.jsonl",
+		},
+		{
+			name:      "invalid alert",
+			args:      []string{"-file", "app.log", "-alert", "latency > 1"},
+			wantError: "unknown metric",
+		},
+		{
+			name:      "alert webhook without rules",
+			args:      []string{"-file", "app.log", "-alert-webhook", "http://localhost/hook"},
+			wantError: "-alert-webhook needs at least one -alert",
+		},
+		{
+			name:      "invalid slo",
+			args:      []string{"-file", "app.log", "-slo", "name=api"},
+			wantError: "name and target are required",
+		},
+		{
+			name:      "anomaly alpha out of range",
+			args:      []string{"-file", "app.log", "-anomaly-sigma", "3", "-anomaly-alpha", "1.5"},
+			wantError: "invalid -anomaly-alpha 1.5",
+		},
+		{
+			name:      "unknown sort key",
+			args:      []string{"-file", "app.log", "-sort", "latency"},
+			wantError: "unknown sort key",
+		},
+		{
+			name:      "invalid order",
+			args:      []string{"-file", "app.log", "-order", "up"},
+			wantError: "invalid -order",
+		},
+		{
+			name:      "unknown color mode",
+			args:      []string{"-file", "app.log", "-color", "sometimes"},
+			wantError: "unknown color mode",
+		},
+		{
+			name:      "unknown log level",
+			args:      []string{"-file", "app.log", "-log-level", "loud"},
+			wantError: "invalid value",
+		},
+		{
+			name:      "unknown log format",
+			args:      []string{"-file", "app.log", "-log-format", "xml"},
+			wantError: "unknown log format",
+		},
+		{
+			name:      "retry max below initial",
+			args:      []string{"-file", "app.log", "-retry-initial", "2s", "-retry-max", "1s"},
+			wantError: "invalid -retry-initial",
+		},
+		{
+			name:      "file options for an unknown file",
+			args:      []string{"-file", "app.log", "-file-options", "other.log?identity=fingerprint"},
+			wantError: "not a -file",
+		},
+		{
+			name:      "unknown file identity",
+			args:      []string{"-file", "app.log", "-file-options", "app.log?identity=name"},
+			wantError: "unknown file identity",
+		},
+		{
+			name:      "negative max line size",
+			args:      []string{"-file", "app.log", "-max-line-bytes", "-1"},
+			wantError: "invalid -max-line-bytes",
+		},
+		{
+			name:      "negative rate",
+			args:      []string{"-file", "app.log", "-global-rate-bytes", "-5"},
+			wantError: "invalid -global-rate-bytes",
+		},
+		{
+			name:      "from-start with start",
+			args:      []string{"-file", "app.log", "-from-start", "-start", "lines:10"},
+			wantError: "mutually exclusive",
+		},
+		{
+			name:      "invalid start",
+			args:      []string{"-file", "app.log", "-start", "yesterday"},
+			wantError: "invalid start position",
+		},
+		{
+			name:      "negative replay speed",
+			args:      []string{"-file", "app.log", "-replay", "-replay-speed", "-2"},
+			wantError: "invalid -replay-speed",
+		},
+		{
+			name:      "replay of several files",
+			args:      []string{"-file", "a.log", "-file", "b.log", "-replay"},
+			wantError: "-replay takes a single -file",
+		},
+		{
+			name:      "negative top",
+			args:      []string{"-file", "app.log", "-top", "-1"},
+			wantError: "invalid -top -1",
+		},
+		{
+			name:      "unknown column",
+			args:      []string{"-file", "app.log", "-columns", "total,p99"},
+			wantError: "unknown column",
+		},
 		{
 			name:      "duplicate file",
 			args:      []string{"-file", "app.log", "-file", "app.log"},
@@ -99,6 +254,49 @@ func TestParseFlags(t *testing.T) {
 			if flags.Interval != tt.wantInterval {
 				t.Errorf("Interval = %v, want %v", flags.Interval, tt.wantInterval)
 			}
+			if flags.DistinctField != tt.wantDistinct {
+				t.Errorf("DistinctField = %q, want %q", flags.DistinctField, tt.wantDistinct)
+			}
 		})
 	}
 }
+
+func TestParseFileOptions(t *testing.T) {
+	path, opts, err := ParseFileOptions("/var/log/a?b.log?identity=fingerprint&fingerprint_bytes=512")
+	if err != nil {
+		t.Fatalf("ParseFileOptions() error = %v", err)
+	}
+	if path != "/var/log/a?b.log" {
+		t.Errorf("path = %q", path)
+	}
+	want := FileOptions{Identity: tailer.IdentityFingerprint, FingerprintSize: 512}
+	if opts != want {
+		t.Errorf("opts = %+v, want %+v", opts, want)
+	}
+
+	// start is taken verbatim, whatever it holds
+	for in, wantStart := range map[string]string{
+		"app.log?framing=pattern&start=^\\d+":             `^\d+`,
+		"app.log?framing=pattern&start=^(GET|POST)?x":     `^(GET|POST)?x`,
+		"app.log?framing=pattern&flush=1s&start=^a&b|c=d": `^a&b|c=d`,
+	} {
+		path, opts, err := ParseFileOptions(in)
+		if err != nil || path != "app.log" || opts.Start.String() != wantStart {
+			t.Errorf("ParseFileOptions(%q) = %q, start %v, %v, want start %q", in, path, opts.Start, err, wantStart)
+		}
+	}
+
+	for _, bad := range []string{
+		"app.log",
+		"app.log?fingerprint_bytes=0",
+		"app.log?colour=red",
+		"app.log?framing=pattern",
+		"app.log?framing=pattern&start=^{(",
+		"app.log?start=^x&framing=pattern", // start swallows what follows it
+		"app.log?rate_lines=-1",
+	} {
+		if _, _, err := ParseFileOptions(bad); err == nil {
+			t.Errorf("ParseFileOptions(%q) expected an error", bad)
+		}
+	}
+}
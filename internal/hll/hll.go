@@ -0,0 +1,135 @@
+package hll
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const (
+	MinPrecision     = 4
+	MaxPrecision     = 16
+	DefaultPrecision = 12 // 4096 registers, ~1.6% standard error
+)
+
+var ErrPrecisionMismatch = errors.New("hll: precision mismatch")
+
+// Sketch is a HyperLogLog distinct-count estimator. Sketches built with the
+// same precision can be merged, in-process or after a MarshalBinary round
+// trip, because the hash function is fixed and unseeded.
+type Sketch struct {
+	p   uint8
+	reg []uint8
+}
+
+func New(precision uint8) (*Sketch, error) {
+	if precision < MinPrecision || precision > MaxPrecision {
+		return nil, fmt.Errorf("hll: precision %d out of range [%d, %d]", precision, MinPrecision, MaxPrecision)
+	}
+	return &Sketch{p: precision, reg: make([]uint8, 1<<precision)}, nil
+}
+
+func (s *Sketch) Precision() uint8 { return s.p }
+
+func (s *Sketch) Add(v []byte) {
+	h := hash(v)
+	idx := h >> (64 - s.p)
+	// leading zeros of the remaining bits, +1; the sentinel bit caps the
+	// rank when every remaining bit is zero
+	rank := uint8(bits.LeadingZeros64(h<<s.p|1<<(s.p-1))) + 1
+	if rank > s.reg[idx] {
+		s.reg[idx] = rank
+	}
+}
+
+func (s *Sketch) AddString(v string) { s.Add([]byte(v)) }
+
+func (s *Sketch) Merge(other *Sketch) error {
+	if other == nil {
+		return nil
+	}
+	if s.p != other.p {
+		return ErrPrecisionMismatch
+	}
+	for i, r := range other.reg {
+		if r > s.reg[i] {
+			s.reg[i] = r
+		}
+	}
+	return nil
+}
+
+func (s *Sketch) Clone() *Sketch {
+	return &Sketch{p: s.p, reg: append([]uint8(nil), s.reg...)}
+}
+
+func (s *Sketch) Estimate() uint64 {
+	m := float64(len(s.reg))
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	est := alpha(len(s.reg)) * m * m / sum
+
+	// small range correction, linear counting
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// MarshalBinary encodes the sketch as the precision byte followed by the
+// registers, so sketches can be shipped between instances and merged.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, 1+len(s.reg))
+	b = append(b, s.p)
+	return append(b, s.reg...), nil
+}
+
+func (s *Sketch) UnmarshalBinary(b []byte) error {
+	if len(b) < 1 {
+		return errors.New("hll: empty encoding")
+	}
+	p := b[0]
+	if p < MinPrecision || p > MaxPrecision {
+		return fmt.Errorf("hll: precision %d out of range", p)
+	}
+	if len(b)-1 != 1<<p {
+		return fmt.Errorf("hll: expected %d registers, got %d", 1<<p, len(b)-1)
+	}
+	s.p = p
+	s.reg = append([]uint8(nil), b[1:]...)
+	return nil
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+	return 0.7213 / (1 + 1.079/float64(m))
+}
+
+// fnv-1a alone has weak high bits, so finish with the splitmix64 mixer
+func hash(v []byte) uint64 {
+	h := uint64(14695981039346656037)
+	for _, c := range v {
+		h ^= uint64(c)
+		h *= 1099511628211
+	}
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
@@ -0,0 +1,106 @@
+package hll
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestSketch_Estimate(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision uint8
+		distinct  int
+		tolerance float64 // relative error allowed
+	}{
+		{name: "empty sketch", precision: DefaultPrecision, distinct: 0},
+		{name: "small cardinality uses linear counting", precision: DefaultPrecision, distinct: 100, tolerance: 0.02},
+		{name: "medium cardinality", precision: DefaultPrecision, distinct: 20000, tolerance: 0.05},
+		{name: "large cardinality", precision: 14, distinct: 200000, tolerance: 0.03},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(tt.precision)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			for i := range tt.distinct {
+				// add every value twice, duplicates must not count
+				s.AddString("10.0." + strconv.Itoa(i))
+				s.AddString("10.0." + strconv.Itoa(i))
+			}
+
+			got := float64(s.Estimate())
+			want := float64(tt.distinct)
+			if want == 0 {
+				if got != 0 {
+					t.Fatalf("Estimate() = %v, want 0", got)
+				}
+				return
+			}
+			if rel := math.Abs(got-want) / want; rel > tt.tolerance {
+				t.Errorf("Estimate() = %v, want %v (relative error %.4f > %.4f)", got, want, rel, tt.tolerance)
+			}
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, _ := New(DefaultPrecision)
+	b, _ := New(DefaultPrecision)
+	union, _ := New(DefaultPrecision)
+	for i := range 5000 {
+		v := "ua-" + strconv.Itoa(i)
+		a.AddString(v)
+		union.AddString(v)
+	}
+	for i := 2500; i < 7500; i++ {
+		v := "ua-" + strconv.Itoa(i)
+		b.AddString(v)
+		union.AddString(v)
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if a.Estimate() != union.Estimate() {
+		t.Errorf("merged estimate %d differs from union estimate %d", a.Estimate(), union.Estimate())
+	}
+
+	other, _ := New(DefaultPrecision + 1)
+	if err := a.Merge(other); err != ErrPrecisionMismatch {
+		t.Errorf("Merge() with different precision error = %v, want %v", err, ErrPrecisionMismatch)
+	}
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	s, _ := New(8)
+	for i := range 1000 {
+		s.AddString(strconv.Itoa(i))
+	}
+	b, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+
+	var got Sketch
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if got.Estimate() != s.Estimate() {
+		t.Errorf("round trip estimate = %d, want %d", got.Estimate(), s.Estimate())
+	}
+
+	if err := got.UnmarshalBinary(b[:10]); err == nil {
+		t.Error("UnmarshalBinary() on short input should fail")
+	}
+}
+
+func TestNew_InvalidPrecision(t *testing.T) {
+	for _, p := range []uint8{0, MinPrecision - 1, MaxPrecision + 1} {
+		if _, err := New(p); err == nil {
+			t.Errorf("New(%d) should fail", p)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package sink
+
+import "fmt"
+
+// default bytes of unsent batches kept while an endpoint is unreachable
+const defaultBacklog = 1 << 20
+
+// backlog keeps the rendered batches a network sink could not deliver yet,
+// and drops the oldest ones once they exceed max bytes.
+type backlog struct {
+	batches [][]byte
+	size    int
+	max     int
+	dropped int // batches dropped since the last report
+}
+
+func newBacklog(max int) *backlog {
+	if max <= 0 {
+		max = defaultBacklog
+	}
+	return &backlog{max: max}
+}
+
+func (b *backlog) push(batch []byte) {
+	b.batches = append(b.batches, batch)
+	b.size += len(batch)
+	for b.size > b.max && len(b.batches) > 1 {
+		b.size -= len(b.batches[0])
+		b.batches = b.batches[1:]
+		b.dropped++
+	}
+}
+
+// flush hands the batches to send oldest first and stops at the first
+// failure, which keeps that batch and the ones after it for the next call.
+func (b *backlog) flush(send func([]byte) error) error {
+	for len(b.batches) > 0 {
+		if err := send(b.batches[0]); err != nil {
+			return b.withDropped(fmt.Errorf("%w, %d batches buffered", err, len(b.batches)))
+		}
+		b.size -= len(b.batches[0])
+		b.batches = b.batches[1:]
+	}
+	return b.withDropped(nil)
+}
+
+func (b *backlog) withDropped(err error) error {
+	if b.dropped == 0 {
+		return err
+	}
+	dropErr := fmt.Errorf("backlog full, dropped %d oldest batches", b.dropped)
+	b.dropped = 0
+	if err == nil {
+		return dropErr
+	}
+	return fmt.Errorf("%w; %v", err, dropErr)
+}
@@ -0,0 +1,39 @@
+package sink
+
+import "accessAggregator/internal/accesslog"
+
+// deltaTracker turns the cumulative rows of successive snapshots into
+// per-interval rows, for protocols that expect increments.
+type deltaTracker struct {
+	last map[string]accesslog.Row
+}
+
+// next returns how much each host grew since the previous call, hosts
+// without new requests are left out. A host whose counters went down, for
+// example evicted and seen again, starts over from zero. Hosts missing from
+// rows are forgotten, so evictions do not grow the tracker.
+func (d *deltaTracker) next(rows []accesslog.Row) []accesslog.Row {
+	if d.last == nil {
+		d.last = make(map[string]accesslog.Row, len(rows))
+	}
+
+	out := make([]accesslog.Row, 0, len(rows))
+	seen := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		seen[r.Host] = true
+		prev, ok := d.last[r.Host]
+		d.last[r.Host] = r
+		if ok && r.Requests >= prev.Requests {
+			r = r.Sub(prev)
+		}
+		if r.Requests > 0 {
+			out = append(out, r)
+		}
+	}
+	for host := range d.last {
+		if !seen[host] {
+			delete(d.last, host)
+		}
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	dialTimeout  = 2 * time.Second
+	writeTimeout = 5 * time.Second
+)
+
+type GraphiteOptions struct {
+	Prefix  string // defaults to "accessagg"
+	Backlog int    // bytes kept while carbon is unreachable, defaults to 1 MiB
+}
+
+// Graphite writes the cumulative per-host counters of every snapshot in the
+// Carbon plaintext protocol over TCP, stamped with the tick time, and the
+// score of every anomaly under the host's anomaly.<metric>. A lost
+// connection is dialled again on the next Write, batches that could not be
+// sent meanwhile are kept up to the backlog size.
+type Graphite struct {
+	addr    string
+	opts    GraphiteOptions
+	conn    net.Conn
+	backlog *backlog
+}
+
+// NewGraphite does not connect, so a carbon relay that is down at start up
+// does not stop the aggregator.
+func NewGraphite(addr string, opts GraphiteOptions) *Graphite {
+	if opts.Prefix == "" {
+		opts.Prefix = "accessagg"
+	}
+	return &Graphite{addr: addr, opts: opts, backlog: newBacklog(opts.Backlog)}
+}
+
+func (g *Graphite) Write(snap Snapshot) error {
+	g.backlog.push(g.render(snap))
+	return g.backlog.flush(g.send)
+}
+
+func (g *Graphite) render(snap Snapshot) []byte {
+	var buf bytes.Buffer
+	ts := " " + strconv.FormatInt(snap.Time.Unix(), 10) + "\n"
+	line := func(host, name, value string) {
+		buf.WriteString(g.opts.Prefix + "." + sanitizeName(host) + "." + name + " " + value + ts)
+	}
+
+	for _, r := range snap.Rows {
+		line(r.Host, "requests", strconv.Itoa(r.Requests))
+		line(r.Host, "requests_2xx", strconv.Itoa(r.Requests2xx))
+		for c, n := range r.ByClass {
+			if n > 0 {
+				line(r.Host, "status."+classNames[c], strconv.Itoa(n))
+			}
+		}
+		line(r.Host, "duration_avg", strconv.FormatFloat(r.AvgDuration(), 'f', -1, 64))
+		if r.Distinct > 0 {
+			line(r.Host, "distinct", strconv.FormatUint(r.Distinct, 10))
+		}
+	}
+	for _, slo := range snap.SLOs {
+		path := g.opts.Prefix + ".slo." + sanitizeName(slo.Name) + "."
+		buf.WriteString(path + "good " + strconv.FormatInt(slo.Good, 10) + ts)
+		buf.WriteString(path + "total " + strconv.FormatInt(slo.Total, 10) + ts)
+		for _, m := range []struct {
+			name  string
+			value float64
+		}{{"budget_remaining", slo.BudgetRemaining}, {"burn_1h", slo.Burn1h}, {"burn_6h", slo.Burn6h}, {"burn_3d", slo.Burn3d}} {
+			buf.WriteString(path + m.name + " " + strconv.FormatFloat(m.value, 'f', -1, 64) + ts)
+		}
+	}
+	for _, e := range snap.Anomalies {
+		line(e.Host, "anomaly."+e.Metric, strconv.FormatFloat(e.Score, 'f', -1, 64))
+	}
+	return buf.Bytes()
+}
+
+func (g *Graphite) send(batch []byte) error {
+	if g.conn == nil {
+		conn, err := net.DialTimeout("tcp", g.addr, dialTimeout)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+
+	g.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := g.conn.Write(batch); err != nil {
+		// the batch may be partly written, carbon drops the torn line
+		g.conn.Close()
+		g.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (g *Graphite) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	return g.conn.Close()
+}
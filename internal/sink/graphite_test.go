@@ -0,0 +1,135 @@
+package sink
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/anomaly"
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+var tick = time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+
+// carbon accepts one connection on ln and streams the lines it receives
+func carbon(t *testing.T, ln net.Listener) <-chan string {
+	t.Helper()
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	return lines
+}
+
+func receive(t *testing.T, lines <-chan string, n int) []string {
+	t.Helper()
+	var got []string
+	for range n {
+		select {
+		case l := <-lines:
+			got = append(got, l)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d of %d lines: %q", len(got), n, got)
+		}
+	}
+	return got
+}
+
+func TestGraphite_Write(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := carbon(t, ln)
+
+	g := NewGraphite(ln.Addr().String(), GraphiteOptions{Prefix: "edge"})
+	defer g.Close()
+	err = g.Write(Snapshot{Time: tick, Rows: []accesslog.Row{
+		{Host: "api.a.com", Requests: 4, Requests2xx: 3, DurationTotal: 1, ByClass: [6]int{2: 3, 5: 1}},
+	}})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	got := receive(t, lines, 5)
+	want := []string{
+		"edge.api_a_com.requests 4 1755137220",
+		"edge.api_a_com.requests_2xx 3 1755137220",
+		"edge.api_a_com.status.2xx 3 1755137220",
+		"edge.api_a_com.status.5xx 1 1755137220",
+		"edge.api_a_com.duration_avg 0.25 1755137220",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestGraphite_Anomalies(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := carbon(t, ln)
+
+	g := NewGraphite(ln.Addr().String(), GraphiteOptions{Prefix: "edge"})
+	defer g.Close()
+	err = g.Write(Snapshot{Time: tick, Anomalies: []anomaly.Event{{Time: tick, Host: "api.a.com", Metric: "error_ratio", Score: 4.5}}})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	if got := receive(t, lines, 1); got[0] != "edge.api_a_com.anomaly.error_ratio 4.5 1755137220" {
+		t.Errorf("sent %q, want the anomaly score", got[0])
+	}
+}
+
+func TestGraphite_BuffersUntilReconnect(t *testing.T) {
+	// reserve a port, then leave it closed so dials fail
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	row := []accesslog.Row{{Host: "a.com", Requests: 1, DurationTotal: 0.1}}
+	// each batch is 3 lines of ~40 bytes, the backlog holds two of them
+	g := NewGraphite(addr, GraphiteOptions{Backlog: 250})
+	defer g.Close()
+	for i := range 3 {
+		if err := g.Write(Snapshot{Time: tick.Add(time.Duration(i) * time.Second), Rows: row}); err == nil {
+			t.Fatal("Write() to a closed port succeeded")
+		}
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port %s was taken meanwhile: %v", addr, err)
+	}
+	defer ln.Close()
+	lines := carbon(t, ln)
+
+	err = g.Write(Snapshot{Time: tick.Add(3 * time.Second), Rows: row})
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 oldest batches") {
+		t.Errorf("Write() error = %v, want report of the dropped batch", err)
+	}
+
+	// the newest buffered tick, then the current one, in order
+	got := receive(t, lines, 2*3)
+	for i, want := range []string{"1755137222", "1755137223"} {
+		if l := got[i*3]; !strings.HasSuffix(l, want) {
+			t.Errorf("batch %d starts with %q, want timestamp %s", i, l, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type InfluxOptions struct {
+	Measurement string // defaults to "access_log"
+	Token       string // sent as "Authorization: Token <token>" over HTTP
+	Backlog     int    // bytes kept while the endpoint fails, defaults to 1 MiB
+}
+
+// Influx writes every snapshot in InfluxDB line protocol, one point per host
+// tagged with the host and stamped with the tick time in nanoseconds, either
+// POSTed to a write endpoint or appended to a file. SLOs and anomalies go to
+// the measurement suffixed with _slo and _anomaly.
+type Influx struct {
+	opts    InfluxOptions
+	send    func([]byte) error
+	close   func() error
+	backlog *backlog
+}
+
+// OpenInflux POSTs to target when it is an http(s) URL, such as
+// http://localhost:8086/api/v2/write?org=o&bucket=b, and appends to the file
+// target otherwise, "-" being stdout.
+func OpenInflux(target string, opts InfluxOptions) (*Influx, error) {
+	if opts.Measurement == "" {
+		opts.Measurement = "access_log"
+	}
+	i := &Influx{opts: opts, backlog: newBacklog(opts.Backlog), close: func() error { return nil }}
+
+	switch {
+	case strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://"):
+		client := &http.Client{Timeout: writeTimeout}
+		i.send = func(batch []byte) error { return i.post(client, target, batch) }
+	case target == "-":
+		i.send = writeAll(os.Stdout)
+	default:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		i.send, i.close = writeAll(f), f.Close
+	}
+	return i, nil
+}
+
+func writeAll(w io.Writer) func([]byte) error {
+	return func(batch []byte) error {
+		_, err := w.Write(batch)
+		return err
+	}
+}
+
+func (i *Influx) post(client *http.Client, url string, batch []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(batch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.opts.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("influx write: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func (i *Influx) Write(snap Snapshot) error {
+	if len(snap.Rows) > 0 || len(snap.SLOs) > 0 || len(snap.Anomalies) > 0 {
+		i.backlog.push(i.render(snap))
+	}
+	return i.backlog.flush(i.send)
+}
+
+func (i *Influx) render(snap Snapshot) []byte {
+	var buf bytes.Buffer
+	ts := strconv.FormatInt(snap.Time.UnixNano(), 10)
+	measurement := measurementEscaper.Replace(i.opts.Measurement)
+
+	for _, r := range snap.Rows {
+		buf.WriteString(measurement + ",host=" + tagEscaper.Replace(r.Host))
+		buf.WriteString(" requests=" + strconv.Itoa(r.Requests) + "i")
+		buf.WriteString(",requests_2xx=" + strconv.Itoa(r.Requests2xx) + "i")
+		for c, n := range r.ByClass {
+			buf.WriteString(",status_" + classNames[c] + "=" + strconv.Itoa(n) + "i")
+		}
+		buf.WriteString(",duration_total=" + strconv.FormatFloat(r.DurationTotal, 'f', -1, 64))
+		buf.WriteString(",duration_avg=" + strconv.FormatFloat(r.AvgDuration(), 'f', -1, 64))
+		if r.Distinct > 0 {
+			buf.WriteString(",distinct=" + strconv.FormatUint(r.Distinct, 10) + "i")
+		}
+		buf.WriteString(" " + ts + "\n")
+	}
+	for _, slo := range snap.SLOs {
+		buf.WriteString(measurement + "_slo,slo=" + tagEscaper.Replace(slo.Name))
+		buf.WriteString(" good=" + strconv.FormatInt(slo.Good, 10) + "i")
+		buf.WriteString(",total=" + strconv.FormatInt(slo.Total, 10) + "i")
+		buf.WriteString(",budget_remaining=" + strconv.FormatFloat(slo.BudgetRemaining, 'f', -1, 64))
+		buf.WriteString(",burn_1h=" + strconv.FormatFloat(slo.Burn1h, 'f', -1, 64))
+		buf.WriteString(",burn_6h=" + strconv.FormatFloat(slo.Burn6h, 'f', -1, 64))
+		buf.WriteString(",burn_3d=" + strconv.FormatFloat(slo.Burn3d, 'f', -1, 64))
+		buf.WriteString(" " + ts + "\n")
+	}
+	for _, e := range snap.Anomalies {
+		buf.WriteString(measurement + "_anomaly,host=" + tagEscaper.Replace(e.Host) + ",metric=" + tagEscaper.Replace(e.Metric))
+		buf.WriteString(" value=" + strconv.FormatFloat(e.Value, 'f', -1, 64))
+		buf.WriteString(",mean=" + strconv.FormatFloat(e.Mean, 'f', -1, 64))
+		buf.WriteString(",stddev=" + strconv.FormatFloat(e.StdDev, 'f', -1, 64))
+		buf.WriteString(",score=" + strconv.FormatFloat(e.Score, 'f', -1, 64))
+		buf.WriteString(" " + ts + "\n")
+	}
+	return buf.Bytes()
+}
+
+func (i *Influx) Close() error {
+	return i.close()
+}
+
+// line protocol escaping, newlines cannot be escaped and are replaced
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", "_")
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, `\`, `\\`, "\n", "_")
+)
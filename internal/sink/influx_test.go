@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/anomaly"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestInflux_Render(t *testing.T) {
+	i, err := OpenInflux(filepath.Join(t.TempDir(), "out.lp"), InfluxOptions{Measurement: "access log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	got := string(i.render(Snapshot{Time: tick, Rows: []accesslog.Row{
+		{Host: `we ird,h=o\st`, Requests: 2, Requests2xx: 1, DurationTotal: 0.5, ByClass: [6]int{2: 1, 4: 1}, Distinct: 2},
+	}, SLOs: []accesslog.SLOStatus{{Name: "api", Target: 0.99, Good: 99, Total: 100, Burn1h: 1}}}))
+	want := `access\ log,host=we\ ird\,h\=o\\st requests=2i,requests_2xx=1i,status_other=0i,status_1xx=0i,status_2xx=1i,status_3xx=0i,status_4xx=1i,status_5xx=0i,duration_total=0.5,duration_avg=0.25,distinct=2i 1755137220000000000` + "\n" +
+		`access\ log_slo,slo=api good=99i,total=100i,budget_remaining=0,burn_1h=1,burn_6h=0,burn_3d=0 1755137220000000000` + "\n"
+	if got != want {
+		t.Errorf("render() = %s\nwant       %s", got, want)
+	}
+}
+
+func TestInflux_RenderAnomalies(t *testing.T) {
+	i, err := OpenInflux(filepath.Join(t.TempDir(), "out.lp"), InfluxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	got := string(i.render(Snapshot{Time: tick, Anomalies: []anomaly.Event{
+		{Time: tick, Host: "a.com", Metric: "rate", Value: 50, Mean: 10, StdDev: 2, Score: 20},
+	}}))
+	want := "access_log_anomaly,host=a.com,metric=rate value=50,mean=10,stddev=2,score=20 1755137220000000000\n"
+	if got != want {
+		t.Errorf("render() = %s\nwant       %s", got, want)
+	}
+}
+
+func TestInflux_HTTP(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+		fail   = true
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Token secret" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if got := r.URL.Query().Get("bucket"); got != "logs" {
+			t.Errorf("bucket = %q", got)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	i, err := OpenInflux(srv.URL+"/api/v2/write?bucket=logs", InfluxOptions{Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	rows := []accesslog.Row{{Host: "a.com", Requests: 1, DurationTotal: 0.1}}
+	if err := i.Write(Snapshot{Time: tick, Rows: rows}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("Write() error = %v, want the 503", err)
+	}
+
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if err := i.Write(Snapshot{Time: tick.Add(10e9), Rows: rows}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 || !strings.HasSuffix(bodies[0], " 1755137220000000000\n") || !strings.HasSuffix(bodies[1], " 1755137230000000000\n") {
+		t.Errorf("server received %q, want the failed tick retried before the new one", bodies)
+	}
+}
+
+func TestInflux_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.lp")
+	i, err := OpenInflux(path, InfluxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	i.Write(Snapshot{Time: tick, Rows: []accesslog.Row{{Host: "a.com", Requests: 1}, {Host: "b.com", Requests: 1}}})
+	i.Write(Snapshot{Time: tick})
+	if err := i.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if n := strings.Count(string(raw), "\n"); n != 2 || !strings.HasPrefix(string(raw), "access_log,host=a.com ") {
+		t.Errorf("file = %q, want one point per host", raw)
+	}
+}
@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// JSON writes every snapshot as one JSON object per line.
+type JSON struct {
+	w   io.Writer
+	enc *json.Encoder
+
+	// when set, hosts only carry these accesslog.Columns besides the name
+	Columns []string
+}
+
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: w, enc: json.NewEncoder(w)}
+}
+
+// OpenJSONFile appends to path, or writes to stdout when path is "-".
+func OpenJSONFile(path string) (*JSON, error) {
+	if path == "-" {
+		return NewJSON(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSON(f), nil
+}
+
+func (j *JSON) Write(s Snapshot) error {
+	if j.Columns == nil {
+		return j.enc.Encode(s)
+	}
+
+	hosts := make([]map[string]any, len(s.Rows))
+	for i, r := range s.Rows {
+		h := map[string]any{"host": r.Host}
+		for _, c := range j.Columns {
+			switch c {
+			case "total":
+				h["requests"] = r.Requests
+			case "2xx":
+				h["requests_2xx"] = r.Requests2xx
+			case "non_2xx":
+				h["requests_non_2xx"] = r.Requests - r.Requests2xx
+			case "5xx":
+				h["requests_5xx"] = r.ByClass[5]
+			case "error_ratio":
+				h["error_ratio"] = r.ErrorRatio()
+			case "avg_duration":
+				h["avg_duration_s"] = r.AvgDuration()
+			case "uniq":
+				h["distinct"] = r.Distinct
+			}
+		}
+		hosts[i] = h
+	}
+	// the outer Rows shadows the embedded one
+	return j.enc.Encode(struct {
+		Snapshot
+		Rows []map[string]any `json:"hosts"`
+	}{s, hosts})
+}
+
+func (j *JSON) Close() error {
+	if c, ok := j.w.(io.Closer); ok && j.w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"accessAggregator/internal/accesslog"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSON_Write(t *testing.T) {
+	var buf bytes.Buffer
+	j := NewJSON(&buf)
+
+	snap := Snapshot{
+		Time:      time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC),
+		Rows:      []accesslog.Row{{Host: "a.com", Requests: 3, Requests2xx: 2, DurationTotal: 0.9, ByClass: [6]int{2: 2, 4: 1}}},
+		Malformed: 1,
+		Inputs:    []InputStats{{Name: "access.log", Dropped: 4}},
+	}
+	if err := j.Write(snap); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := j.Write(Snapshot{Final: true}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one line per snapshot, got %q", buf.String())
+	}
+	want := `{"time":"2025-08-14T02:07:00Z","final":false,"hosts":[{"host":"a.com","requests":3,"requests_2xx":2,"duration_total_s":0.9,"by_class":[0,0,2,0,1,0]}],"malformed":1,"inputs":[{"name":"access.log","blocked_ns":0,"dropped":4}]}`
+	if lines[0] != want {
+		t.Errorf("line = %s\nwant  %s", lines[0], want)
+	}
+
+	var back Snapshot
+	if err := json.Unmarshal([]byte(lines[0]), &back); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+}
+
+func TestOpenJSONFile_Appends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	for range 2 {
+		j, err := OpenJSONFile(path)
+		if err != nil {
+			t.Fatalf("OpenJSONFile() error = %v", err)
+		}
+		j.Write(Snapshot{})
+		if err := j.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	raw, _ := os.ReadFile(path)
+	if n := strings.Count(string(raw), "\n"); n != 2 {
+		t.Errorf("expected 2 appended lines, got %d", n)
+	}
+}
+
+func TestJSON_ColumnsAndView(t *testing.T) {
+	var buf bytes.Buffer
+	j := NewJSON(&buf)
+	j.Columns = []string{"total", "error_ratio"}
+	s := WithView(j, accesslog.View{Sort: accesslog.SortTotal, Desc: true, Top: 1})
+
+	err := s.Write(Snapshot{Rows: []accesslog.Row{
+		{Host: "a.com", Requests: 1, ByClass: [6]int{5: 1}},
+		{Host: "b.com", Requests: 4, ByClass: [6]int{2: 3, 5: 1}},
+		{Host: "c.com", Requests: 1, ByClass: [6]int{2: 1}},
+	}})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var got struct {
+		Hosts []map[string]any `json:"hosts"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	want := []map[string]any{
+		{"host": "b.com", "requests": 4.0, "error_ratio": 0.25},
+		{"host": accesslog.OthersRow, "requests": 2.0, "error_ratio": 0.5},
+	}
+	if !reflect.DeepEqual(got.Hosts, want) {
+		t.Errorf("hosts = %v, want %v", got.Hosts, want)
+	}
+}
@@ -0,0 +1,169 @@
+package sink
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/anomaly"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot is everything a tick produced, as plain values. Public as
+// aggregator.Snapshot, changes must keep its compatibility promise.
+type Snapshot struct {
+	Time      time.Time       `json:"time"`
+	Final     bool            `json:"final"`
+	Rows      []accesslog.Row `json:"hosts"`
+	Malformed int             `json:"malformed"`
+	Overflow  int             `json:"overflow,omitempty"`
+	Inputs    []InputStats    `json:"inputs,omitempty"`
+
+	SLOs      []accesslog.SLOStatus `json:"slos,omitempty"`
+	Anomalies []anomaly.Event       `json:"anomalies,omitempty"`
+}
+
+type InputStats struct {
+	Name    string        `json:"name"`
+	State   string        `json:"state,omitempty"` // opening, waiting, tailing, errored, done or failed
+	Blocked time.Duration `json:"blocked_ns"`
+	Dropped int64         `json:"dropped"`
+	// lines skipped for exceeding the max line size
+	Oversize int64 `json:"oversize,omitempty"`
+	// time spent waiting on rate limits, and whether the input is waiting
+	// on them now
+	Throttled  time.Duration `json:"throttled_ns,omitempty"`
+	Throttling bool          `json:"throttling,omitempty"`
+}
+
+// Sink receives one Snapshot per tick. Write is never called concurrently
+// for the same sink, and Close is called once after the last Write. Public
+// as aggregator.Sink, changes must keep its compatibility promise.
+type Sink interface {
+	Write(s Snapshot) error
+	Close() error
+}
+
+// WithView returns s seeing the rows of every snapshot through v. Rows
+// come sorted by host, so a View that only picks columns leaves s as is.
+func WithView(s Sink, v accesslog.View) Sink {
+	if v.Sort == accesslog.SortHost && !v.Desc && v.Top == 0 {
+		return s
+	}
+	return viewSink{s, v}
+}
+
+type viewSink struct {
+	Sink
+	view accesslog.View
+}
+
+func (v viewSink) Write(s Snapshot) error {
+	s.Rows = v.view.Apply(s.Rows)
+	return v.Sink.Write(s)
+}
+
+// Spec selects a sink on the command line: kind=target?param=value
+type Spec struct {
+	Kind   string
+	Target string
+	Params url.Values
+}
+
+func ParseSpec(s string) (Spec, error) {
+	kind, rest, ok := strings.Cut(s, "=")
+	if !ok || kind == "" || rest == "" {
+		return Spec{}, fmt.Errorf("invalid sink %q: want kind=target", s)
+	}
+	target, query, _ := strings.Cut(rest, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return Spec{}, fmt.Errorf("invalid sink %q params: %w", s, err)
+	}
+	return Spec{Kind: kind, Target: target, Params: params}, nil
+}
+
+func (s Spec) String() string {
+	if len(s.Params) == 0 {
+		return s.Kind + "=" + s.Target
+	}
+	return s.Kind + "=" + s.Target + "?" + s.Params.Encode()
+}
+
+// queued snapshots per sink before new ones are dropped for it
+const queueSize = 4
+
+// FanOut hands every snapshot to each sink on that sink's own goroutine.
+// Publish never blocks: a sink that is slow or failing only loses its own
+// snapshots, which is reported, and never holds back aggregation or the
+// other sinks.
+type FanOut struct {
+	workers []*worker
+	report  func(name string, err error)
+}
+
+type worker struct {
+	name  string
+	sink  Sink
+	queue chan Snapshot
+	done  chan struct{}
+}
+
+// NewFanOut starts one goroutine per named sink, report is called from
+// those goroutines for every failed Write and dropped snapshot.
+func NewFanOut(sinks map[string]Sink, report func(name string, err error)) *FanOut {
+	f := &FanOut{report: report}
+	for name, s := range sinks {
+		w := &worker{name: name, sink: s, queue: make(chan Snapshot, queueSize), done: make(chan struct{})}
+		f.workers = append(f.workers, w)
+		go w.run(report)
+	}
+	return f
+}
+
+func (w *worker) run(report func(string, error)) {
+	defer close(w.done)
+	for s := range w.queue {
+		if err := w.sink.Write(s); err != nil {
+			report(w.name, err)
+		}
+	}
+}
+
+func (f *FanOut) Publish(s Snapshot) {
+	for _, w := range f.workers {
+		select {
+		case w.queue <- s:
+		default:
+			f.report(w.name, fmt.Errorf("sink is behind, dropped snapshot of %s", s.Time.Format(time.RFC3339)))
+		}
+	}
+}
+
+// Close lets every sink drain its queue for up to timeout, then closes
+// them. A sink still stuck in Write after timeout is abandoned.
+func (f *FanOut) Close(timeout time.Duration) {
+	for _, w := range f.workers {
+		close(w.queue)
+	}
+
+	// a closed Done reaches every worker, unlike a timer channel
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, w := range f.workers {
+		wg.Go(func() {
+			select {
+			case <-w.done:
+				if err := w.sink.Close(); err != nil {
+					f.report(w.name, err)
+				}
+			case <-ctx.Done():
+				f.report(w.name, fmt.Errorf("sink did not finish within %v, giving up", timeout))
+			}
+		})
+	}
+	wg.Wait()
+}
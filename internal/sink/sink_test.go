@@ -0,0 +1,209 @@
+package sink
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      Spec
+		wantError string
+	}{
+		{
+			name: "kind and target",
+			in:   "json=out.jsonl",
+			want: Spec{Kind: "json", Target: "out.jsonl", Params: map[string][]string{}},
+		},
+		{
+			name: "with params",
+			in:   "statsd=127.0.0.1:8125?prefix=edge&tag=env:prod&tag=dc:ams",
+			want: Spec{Kind: "statsd", Target: "127.0.0.1:8125", Params: map[string][]string{
+				"prefix": {"edge"},
+				"tag":    {"env:prod", "dc:ams"},
+			}},
+		},
+		{name: "missing target", in: "json=", wantError: "want kind=target"},
+		{name: "missing kind", in: "=out.jsonl", wantError: "want kind=target"},
+		{name: "no separator", in: "json", wantError: "want kind=target"},
+		{name: "bad params", in: "json=out?%zz", wantError: "params"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSpec(tt.in)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("ParseSpec() error = %v, want %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSpec() error = %v", err)
+			}
+			if got.Kind != tt.want.Kind || got.Target != tt.want.Target || !reflect.DeepEqual(map[string][]string(got.Params), map[string][]string(tt.want.Params)) {
+				t.Errorf("ParseSpec() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// recordSink collects snapshots, optionally failing or blocking on Write
+type recordSink struct {
+	mu      sync.Mutex
+	got     []Snapshot
+	err     error
+	block   chan struct{}
+	closed  bool
+	written chan struct{}
+}
+
+func newRecordSink() *recordSink {
+	return &recordSink{written: make(chan struct{}, 100)}
+}
+
+func (r *recordSink) Write(s Snapshot) error {
+	if r.block != nil {
+		<-r.block
+	}
+	r.mu.Lock()
+	r.got = append(r.got, s)
+	r.mu.Unlock()
+	r.written <- struct{}{}
+	return r.err
+}
+
+func (r *recordSink) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	return nil
+}
+
+func (r *recordSink) snapshots() []Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Snapshot(nil), r.got...)
+}
+
+type reports struct {
+	mu   sync.Mutex
+	errs map[string][]string
+}
+
+func (r *reports) report(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.errs == nil {
+		r.errs = map[string][]string{}
+	}
+	r.errs[name] = append(r.errs[name], err.Error())
+}
+
+func (r *reports) get(name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.errs[name]
+}
+
+func TestFanOut_IsolatesSinks(t *testing.T) {
+	healthy := newRecordSink()
+	failing := newRecordSink()
+	failing.err = errors.New("connection refused")
+	stuck := newRecordSink()
+	stuck.block = make(chan struct{})
+
+	var rep reports
+	f := NewFanOut(map[string]Sink{"healthy": healthy, "failing": failing, "stuck": stuck}, rep.report)
+
+	base := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	published := make(chan struct{})
+	go func() {
+		for i := range 10 {
+			f.Publish(Snapshot{Time: base.Add(time.Duration(i) * time.Second)})
+			// let the healthy and failing sinks keep up
+			<-healthy.written
+			<-failing.written
+		}
+		close(published)
+	}()
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a stuck sink")
+	}
+
+	if got := len(healthy.snapshots()); got != 10 {
+		t.Errorf("healthy sink got %d snapshots, want 10", got)
+	}
+	// the report of the last write may still be in flight
+	if got := rep.get("failing"); len(got) < 9 || !strings.Contains(got[0], "connection refused") {
+		t.Errorf("failing sink report = %v", got)
+	}
+	// one in Write, queueSize queued, the rest dropped
+	if got := len(rep.get("stuck")); got != 10-1-queueSize {
+		t.Errorf("stuck sink reported %d drops, want %d: %v", got, 10-1-queueSize, rep.get("stuck"))
+	}
+	if len(rep.get("healthy")) != 0 {
+		t.Errorf("healthy sink reported errors: %v", rep.get("healthy"))
+	}
+
+	f.Close(50 * time.Millisecond)
+	if !healthy.closed || !failing.closed {
+		t.Error("Close() did not close finished sinks")
+	}
+	if stuck.closed {
+		t.Error("Close() closed a sink still inside Write")
+	}
+	if r := rep.get("stuck"); !strings.Contains(r[len(r)-1], "did not finish") {
+		t.Errorf("expected give up report for stuck sink, got %v", r)
+	}
+	close(stuck.block)
+}
+
+func TestFanOut_CloseGivesUpOnEveryStuckSink(t *testing.T) {
+	a, b := newRecordSink(), newRecordSink()
+	a.block, b.block = make(chan struct{}), make(chan struct{})
+	defer close(a.block)
+	defer close(b.block)
+
+	var rep reports
+	f := NewFanOut(map[string]Sink{"a": a, "b": b}, rep.report)
+	f.Publish(Snapshot{Final: true})
+
+	closed := make(chan struct{})
+	go func() {
+		f.Close(50 * time.Millisecond)
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close() hung with two sinks stuck in Write")
+	}
+	if len(rep.get("a")) != 1 || len(rep.get("b")) != 1 {
+		t.Errorf("want one give up report per sink, got a=%v b=%v", rep.get("a"), rep.get("b"))
+	}
+}
+
+func TestFanOut_CloseDrainsQueue(t *testing.T) {
+	s := newRecordSink()
+	var rep reports
+	f := NewFanOut(map[string]Sink{"s": s}, rep.report)
+
+	f.Publish(Snapshot{Malformed: 1})
+	f.Publish(Snapshot{Malformed: 2, Final: true})
+	f.Close(time.Second)
+
+	got := s.snapshots()
+	if len(got) != 2 || !got[1].Final {
+		t.Errorf("sink got %+v, want both snapshots ending with the final one", got)
+	}
+}
@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"accessAggregator/internal/accesslog"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// safe payload for a single UDP datagram on a 1500 byte MTU path
+const defaultMaxPacket = 1432
+
+type StatsDOptions struct {
+	Prefix string // defaults to "accessagg"
+	// DogStatsD puts the host in a tag instead of the metric name, and
+	// appends Tags (key:value) to every metric
+	DogStatsD bool
+	Tags      []string
+	MaxPacket int // bytes per datagram, defaults to defaultMaxPacket
+	// applied to the increments of each interval, not to the cumulative
+	// rows, so hosts moving in and out of View.Top keep exact counts
+	View accesslog.View
+}
+
+// StatsD sends per-host request counters, per status class counters and
+// the average duration of each interval as StatsD metrics over UDP, the
+// budget and burn rates of every SLO as gauges, and a count of anomalies per
+// host and metric.
+type StatsD struct {
+	conn   net.Conn
+	opts   StatsDOptions
+	tags   string // pre rendered "|#a:b,c:d" suffix without the host
+	deltas deltaTracker
+	packet []byte
+}
+
+func NewStatsD(addr string, opts StatsDOptions) (*StatsD, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "accessagg"
+	}
+	if opts.MaxPacket <= 0 {
+		opts.MaxPacket = defaultMaxPacket
+	}
+	if len(opts.Tags) > 0 && !opts.DogStatsD {
+		return nil, fmt.Errorf("tags need the DogStatsD format")
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{conn: conn, opts: opts, packet: make([]byte, 0, opts.MaxPacket)}
+	for _, t := range opts.Tags {
+		s.tags += "," + sanitizeTag(t)
+	}
+	return s, nil
+}
+
+var classNames = [6]string{"other", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+func (s *StatsD) Write(snap Snapshot) error {
+	for _, r := range s.opts.View.Apply(s.deltas.next(snap.Rows)) {
+		if err := s.metric(r.Host, "requests", strconv.Itoa(r.Requests), "c"); err != nil {
+			return err
+		}
+		for c, n := range r.ByClass {
+			if n == 0 {
+				continue
+			}
+			if err := s.metric(r.Host, "status."+classNames[c], strconv.Itoa(n), "c"); err != nil {
+				return err
+			}
+		}
+		avgMs := strconv.FormatFloat(r.AvgDuration()*1000, 'f', 3, 64)
+		if err := s.metric(r.Host, "duration", avgMs, "ms"); err != nil {
+			return err
+		}
+	}
+	// unique counts are estimates over the whole run, not increments
+	for _, r := range snap.Rows {
+		if r.Distinct == 0 {
+			continue
+		}
+		if err := s.metric(r.Host, "distinct", strconv.FormatUint(r.Distinct, 10), "g"); err != nil {
+			return err
+		}
+	}
+	for _, slo := range snap.SLOs {
+		for _, m := range []struct {
+			name  string
+			value float64
+		}{{"budget_remaining", slo.BudgetRemaining}, {"burn_1h", slo.Burn1h}, {"burn_6h", slo.Burn6h}, {"burn_3d", slo.Burn3d}} {
+			if err := s.sloGauge(slo.Name, m.name, strconv.FormatFloat(m.value, 'f', -1, 64)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, e := range snap.Anomalies {
+		if err := s.metric(e.Host, "anomaly."+e.Metric, "1", "c"); err != nil {
+			return err
+		}
+	}
+	return s.flush()
+}
+
+func (s *StatsD) metric(host, name, value, typ string) error {
+	if s.opts.DogStatsD {
+		return s.add(s.opts.Prefix + "." + name + ":" + value + "|" + typ + "|#host:" + sanitizeTag(host) + s.tags)
+	}
+	return s.add(s.opts.Prefix + "." + sanitizeName(host) + "." + name + ":" + value + "|" + typ)
+}
+
+// sloGauge is metric for an SLO instead of a host
+func (s *StatsD) sloGauge(slo, name, value string) error {
+	if s.opts.DogStatsD {
+		return s.add(s.opts.Prefix + ".slo." + name + ":" + value + "|g|#slo:" + sanitizeTag(slo) + s.tags)
+	}
+	return s.add(s.opts.Prefix + ".slo." + sanitizeName(slo) + "." + name + ":" + value + "|g")
+}
+
+// add batches line, sending the batch first when line would not fit
+func (s *StatsD) add(line string) error {
+	if len(s.packet) > 0 && len(s.packet)+1+len(line) > s.opts.MaxPacket {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	if len(s.packet) > 0 {
+		s.packet = append(s.packet, '\n')
+	}
+	s.packet = append(s.packet, line...)
+	return nil
+}
+
+func (s *StatsD) flush() error {
+	if len(s.packet) == 0 {
+		return nil
+	}
+	_, err := s.conn.Write(s.packet)
+	s.packet = s.packet[:0]
+	return err
+}
+
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
+
+// dots would split a host into several name segments, the rest is reserved
+// by the StatsD and Carbon line formats
+var nameReplacer = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+func sanitizeName(s string) string { return nameReplacer.Replace(s) }
+
+var tagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", " ", "_", "\n", "_")
+
+func sanitizeTag(s string) string { return tagReplacer.Replace(s) }
@@ -0,0 +1,264 @@
+package sink
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/anomaly"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listenUDP(t *testing.T) net.PacketConn {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// readPackets collects datagrams until none arrives for a short while
+func readPackets(t *testing.T, pc net.PacketConn) []string {
+	t.Helper()
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		pc.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func lines(packets []string) []string {
+	var out []string
+	for _, p := range packets {
+		out = append(out, strings.Split(p, "\n")...)
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestStatsD_SendsDeltas(t *testing.T) {
+	pc := listenUDP(t)
+	s, err := NewStatsD(pc.LocalAddr().String(), StatsDOptions{Prefix: "edge"})
+	if err != nil {
+		t.Fatalf("NewStatsD() error = %v", err)
+	}
+	defer s.Close()
+
+	first := Snapshot{Rows: []accesslog.Row{
+		{Host: "a.com", Requests: 2, Requests2xx: 1, DurationTotal: 0.5, ByClass: [6]int{2: 1, 5: 1}},
+		{Host: "b.com", Requests: 1, Requests2xx: 1, DurationTotal: 0.1, ByClass: [6]int{2: 1}},
+	}}
+	if err := s.Write(first); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got := lines(readPackets(t, pc))
+	want := []string{
+		"edge.a_com.duration:250.000|ms",
+		"edge.a_com.requests:2|c",
+		"edge.a_com.status.2xx:1|c",
+		"edge.a_com.status.5xx:1|c",
+		"edge.b_com.duration:100.000|ms",
+		"edge.b_com.requests:1|c",
+		"edge.b_com.status.2xx:1|c",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("first tick sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// summaries are cumulative, only growth since the last tick is sent and
+	// idle hosts are skipped
+	second := Snapshot{Rows: []accesslog.Row{
+		{Host: "a.com", Requests: 3, Requests2xx: 2, DurationTotal: 0.8, ByClass: [6]int{2: 2, 5: 1}},
+		{Host: "b.com", Requests: 1, Requests2xx: 1, DurationTotal: 0.1, ByClass: [6]int{2: 1}},
+	}}
+	if err := s.Write(second); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got = lines(readPackets(t, pc))
+	want = []string{
+		"edge.a_com.duration:300.000|ms",
+		"edge.a_com.requests:1|c",
+		"edge.a_com.status.2xx:1|c",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("second tick sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStatsD_TopOfIncrements(t *testing.T) {
+	pc := listenUDP(t)
+	s, err := NewStatsD(pc.LocalAddr().String(), StatsDOptions{
+		Prefix: "edge",
+		View:   accesslog.View{Sort: accesslog.SortTotal, Desc: true, Top: 1},
+	})
+	if err != nil {
+		t.Fatalf("NewStatsD() error = %v", err)
+	}
+	defer s.Close()
+
+	s.Write(Snapshot{Rows: []accesslog.Row{
+		{Host: "a.com", Requests: 5, ByClass: [6]int{2: 5}},
+		{Host: "b.com", Requests: 3, ByClass: [6]int{2: 3}},
+	}})
+	readPackets(t, pc)
+
+	// b.com moves into the top, only its growth is sent and others only
+	// holds the growth of a.com
+	s.Write(Snapshot{Rows: []accesslog.Row{
+		{Host: "a.com", Requests: 6, ByClass: [6]int{2: 6}},
+		{Host: "b.com", Requests: 10, ByClass: [6]int{2: 10}},
+	}})
+	var got []string
+	for _, l := range lines(readPackets(t, pc)) {
+		if !strings.Contains(l, "duration") {
+			got = append(got, l)
+		}
+	}
+	want := []string{
+		"edge.__others__.requests:1|c",
+		"edge.__others__.status.2xx:1|c",
+		"edge.b_com.requests:7|c",
+		"edge.b_com.status.2xx:7|c",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("second tick sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDeltaTracker_ForgetsEvictedHosts(t *testing.T) {
+	var d deltaTracker
+	d.next([]accesslog.Row{{Host: "a.com", Requests: 5}, {Host: "b.com", Requests: 2}})
+	d.next([]accesslog.Row{{Host: "b.com", Requests: 3}, {Host: "c.com", Requests: 1}})
+	if _, ok := d.last["a.com"]; ok || len(d.last) != 2 {
+		t.Errorf("tracker kept %v, want only the hosts of the last rows", d.last)
+	}
+	// back after eviction, counted from zero again
+	got := d.next([]accesslog.Row{{Host: "a.com", Requests: 4}})
+	if len(got) != 1 || got[0].Requests != 4 {
+		t.Errorf("next() = %+v, want a.com with 4 requests", got)
+	}
+}
+
+func TestStatsD_DogStatsDTags(t *testing.T) {
+	pc := listenUDP(t)
+	s, err := NewStatsD(pc.LocalAddr().String(), StatsDOptions{DogStatsD: true, Tags: []string{"env:prod"}})
+	if err != nil {
+		t.Fatalf("NewStatsD() error = %v", err)
+	}
+	defer s.Close()
+
+	s.Write(Snapshot{Rows: []accesslog.Row{{Host: "a.com", Requests: 1, DurationTotal: 0.2, ByClass: [6]int{4: 1}, Distinct: 7}}})
+	got := lines(readPackets(t, pc))
+	want := []string{
+		"accessagg.distinct:7|g|#host:a.com,env:prod",
+		"accessagg.duration:200.000|ms|#host:a.com,env:prod",
+		"accessagg.requests:1|c|#host:a.com,env:prod",
+		"accessagg.status.4xx:1|c|#host:a.com,env:prod",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStatsD_SLOGauges(t *testing.T) {
+	slos := []accesslog.SLOStatus{{Name: "api", Target: 0.99, Good: 99, Total: 100, BudgetRemaining: 0.5, Burn1h: 2, Burn6h: 1.5, Burn3d: 0.25}}
+	for _, tt := range []struct {
+		opts StatsDOptions
+		want []string
+	}{
+		{StatsDOptions{}, []string{
+			"accessagg.slo.api.budget_remaining:0.5|g",
+			"accessagg.slo.api.burn_1h:2|g",
+			"accessagg.slo.api.burn_3d:0.25|g",
+			"accessagg.slo.api.burn_6h:1.5|g",
+		}},
+		{StatsDOptions{DogStatsD: true, Tags: []string{"env:prod"}}, []string{
+			"accessagg.slo.budget_remaining:0.5|g|#slo:api,env:prod",
+			"accessagg.slo.burn_1h:2|g|#slo:api,env:prod",
+			"accessagg.slo.burn_3d:0.25|g|#slo:api,env:prod",
+			"accessagg.slo.burn_6h:1.5|g|#slo:api,env:prod",
+		}},
+	} {
+		pc := listenUDP(t)
+		s, err := NewStatsD(pc.LocalAddr().String(), tt.opts)
+		if err != nil {
+			t.Fatalf("NewStatsD() error = %v", err)
+		}
+		s.Write(Snapshot{SLOs: slos})
+		s.Close()
+		if got := lines(readPackets(t, pc)); !slices.Equal(got, tt.want) {
+			t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestStatsD_Anomalies(t *testing.T) {
+	events := []anomaly.Event{{Host: "a.com", Metric: "rate", Score: 4.2}, {Host: "a.com", Metric: "error_ratio", Score: -3.5}}
+	for _, tt := range []struct {
+		opts StatsDOptions
+		want []string
+	}{
+		{StatsDOptions{}, []string{
+			"accessagg.a_com.anomaly.error_ratio:1|c",
+			"accessagg.a_com.anomaly.rate:1|c",
+		}},
+		{StatsDOptions{DogStatsD: true, Tags: []string{"env:prod"}}, []string{
+			"accessagg.anomaly.error_ratio:1|c|#host:a.com,env:prod",
+			"accessagg.anomaly.rate:1|c|#host:a.com,env:prod",
+		}},
+	} {
+		pc := listenUDP(t)
+		s, err := NewStatsD(pc.LocalAddr().String(), tt.opts)
+		if err != nil {
+			t.Fatalf("NewStatsD() error = %v", err)
+		}
+		s.Write(Snapshot{Anomalies: events})
+		s.Close()
+		if got := lines(readPackets(t, pc)); !slices.Equal(got, tt.want) {
+			t.Errorf("sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestStatsD_BatchesUnderMaxPacket(t *testing.T) {
+	pc := listenUDP(t)
+	const maxPacket = 120
+	s, err := NewStatsD(pc.LocalAddr().String(), StatsDOptions{MaxPacket: maxPacket})
+	if err != nil {
+		t.Fatalf("NewStatsD() error = %v", err)
+	}
+	defer s.Close()
+
+	var rows []accesslog.Row
+	for _, h := range []string{"a.com", "b.com", "c.com", "d.com", "e.com"} {
+		rows = append(rows, accesslog.Row{Host: h, Requests: 1, DurationTotal: 0.1, ByClass: [6]int{2: 1}})
+	}
+	s.Write(Snapshot{Rows: rows})
+
+	packets := readPackets(t, pc)
+	if len(packets) < 2 {
+		t.Fatalf("expected metrics split over several packets, got %d", len(packets))
+	}
+	for _, p := range packets {
+		if len(p) > maxPacket {
+			t.Errorf("packet of %d bytes exceeds %d: %q", len(p), maxPacket, p)
+		}
+	}
+	if n := len(lines(packets)); n != 3*len(rows) {
+		t.Errorf("received %d metrics, want %d", n, 3*len(rows))
+	}
+}
+
+func TestNewStatsD_TagsNeedDogStatsD(t *testing.T) {
+	if _, err := NewStatsD("127.0.0.1:8125", StatsDOptions{Tags: []string{"env:prod"}}); err == nil {
+		t.Error("expected an error for tags on plain statsd")
+	}
+}
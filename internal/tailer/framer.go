@@ -0,0 +1,228 @@
+package tailer
+
+import (
+	"accessAggregator/internal/clock"
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+// Framing decides how a Framer joins lines into records.
+type Framing int
+
+const (
+	// one record per line, no Framer needed
+	FrameLines Framing = iota
+	// a record is a brace balanced JSON object, over as many lines as it
+	// takes, for pretty printed logs
+	FrameJSON
+	// a record starts at a line matching FramerOptions.Start
+	FramePattern
+)
+
+func ParseFraming(s string) (Framing, error) {
+	switch s {
+	case "lines":
+		return FrameLines, nil
+	case "json":
+		return FrameJSON, nil
+	case "pattern":
+		return FramePattern, nil
+	}
+	return 0, fmt.Errorf("unknown framing %q: want lines, json or pattern", s)
+}
+
+const defaultFlushTimeout = time.Second
+
+// FramerOptions is public as aggregator.Framing, changes must keep its
+// compatibility promise.
+type FramerOptions struct {
+	Framing Framing
+	Start   *regexp.Regexp // for FramePattern
+	// a pending record is returned once no line followed it for this long,
+	// 0 for a second
+	FlushTimeout time.Duration
+	// a pending record growing past this is dropped up to its end and
+	// counted in Oversize, like an oversize line. 0 for no limit.
+	MaxSize int
+	Clock   clock.Clock // defaults to clock.Real
+}
+
+// Framer is a Tailer joining the lines of another one into multiline
+// records. It works on any Tailer, files or custom sources alike.
+type Framer struct {
+	src  Tailer
+	opts FramerOptions
+
+	pending  []byte
+	lastLine time.Time
+	// JSON state carried from line to line
+	depth    int
+	inString bool
+	escaped  bool
+	// discarding the lines of an oversize record
+	dropping bool
+	oversize int64
+	// the source is exhausted, return it once pending is flushed
+	srcErr error
+}
+
+func NewFramer(src Tailer, opts FramerOptions) *Framer {
+	opts.FlushTimeout = cmp.Or(opts.FlushTimeout, defaultFlushTimeout)
+	if opts.Clock == nil {
+		opts.Clock = clock.Real{}
+	}
+	return &Framer{src: src, opts: opts}
+}
+
+func (f *Framer) GetRawRecord() ([]byte, error) {
+	for {
+		if f.srcErr != nil {
+			if len(f.pending) > 0 {
+				return f.flush(), nil
+			}
+			return nil, f.srcErr
+		}
+
+		line, err := f.src.GetRawRecord()
+		if err == io.EOF {
+			if f.opts.Clock.Since(f.lastLine) >= f.opts.FlushTimeout {
+				if f.dropping {
+					f.flush() // the dropped record ended too
+				} else if len(f.pending) > 0 {
+					return f.flush(), nil
+				}
+			}
+			return nil, io.EOF
+		}
+		if err == ErrExhausted {
+			f.srcErr = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.lastLine = f.opts.Clock.Now()
+
+		var record []byte
+		switch f.opts.Framing {
+		case FrameJSON:
+			record = f.addJSON(line)
+		case FramePattern:
+			record = f.addPattern(line)
+		default:
+			return line, nil
+		}
+		if record != nil {
+			return record, nil
+		}
+	}
+}
+
+// addJSON appends line and returns the pending record once its braces
+// balance. Blank lines between objects are dropped, and so is an oversize
+// record up to its closing brace.
+func (f *Framer) addJSON(line []byte) []byte {
+	for _, c := range line {
+		switch {
+		case f.escaped:
+			f.escaped = false
+		case f.inString:
+			switch c {
+			case '\\':
+				f.escaped = true
+			case '"':
+				f.inString = false
+			}
+		case c == '"':
+			f.inString = true
+		case c == '{':
+			f.depth++
+		case c == '}':
+			f.depth--
+		}
+	}
+	f.add(line)
+	if f.depth > 0 {
+		return nil
+	}
+	if f.dropping || len(bytes.TrimSpace(f.pending)) == 0 {
+		f.flush()
+		return nil
+	}
+	return f.flush()
+}
+
+// addPattern returns the pending record when line starts the next one. An
+// oversize record is dropped up to the next start.
+func (f *Framer) addPattern(line []byte) []byte {
+	var record []byte
+	if f.opts.Start.Match(bytes.TrimRight(line, "\r\n")) {
+		if f.dropping {
+			f.flush()
+		} else if len(f.pending) > 0 {
+			record = f.flush()
+		}
+	}
+	f.add(line)
+	return record
+}
+
+// add appends line to the pending record, or drops the record up to its end
+// once line would grow it past MaxSize. The JSON state stays, to find where
+// the record ends.
+func (f *Framer) add(line []byte) {
+	if f.dropping {
+		return
+	}
+	if f.opts.MaxSize > 0 && len(f.pending)+len(line) > f.opts.MaxSize {
+		f.pending = nil
+		f.dropping = true
+		f.oversize++
+		return
+	}
+	f.pending = append(f.pending, line...)
+}
+
+func (f *Framer) flush() []byte {
+	record := f.pending
+	f.pending = nil
+	f.depth, f.inString, f.escaped = 0, false, false
+	f.dropping = false
+	return record
+}
+
+// Flush returns the pending record at once, for a caller stopping before
+// the record is complete or timed out. An oversize record being dropped is
+// not returned.
+func (f *Framer) Flush() []byte {
+	if f.dropping {
+		f.flush()
+		return nil
+	}
+	return f.flush()
+}
+
+func (f *Framer) Close() error {
+	return f.src.Close()
+}
+
+// Oversize is how many records past FramerOptions.MaxSize were dropped,
+// plus the oversize lines of the source, see TailFile.Oversize.
+func (f *Framer) Oversize() int64 {
+	if o, ok := f.src.(interface{ Oversize() int64 }); ok {
+		return f.oversize + o.Oversize()
+	}
+	return f.oversize
+}
+
+// Err forwards to the source, see TailFile.Err.
+func (f *Framer) Err() error {
+	if r, ok := f.src.(interface{ Err() error }); ok {
+		return r.Err()
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package tailer
+
+import (
+	"accessAggregator/internal/clock"
+	"io"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// lineTailer hands out lines, then io.EOF until more are added
+type lineTailer struct {
+	lines     []string
+	exhausted bool
+}
+
+func (l *lineTailer) GetRawRecord() ([]byte, error) {
+	if len(l.lines) == 0 {
+		if l.exhausted {
+			return nil, ErrExhausted
+		}
+		return nil, io.EOF
+	}
+	line := l.lines[0]
+	l.lines = l.lines[1:]
+	return []byte(line), nil
+}
+
+func (l *lineTailer) Close() error { return nil }
+
+func records(t *testing.T, f *Framer) []string {
+	t.Helper()
+	var got []string
+	for {
+		rec, err := f.GetRawRecord()
+		if err != nil {
+			return got
+		}
+		got = append(got, string(rec))
+	}
+}
+
+func TestFramer_JSON(t *testing.T) {
+	src := &lineTailer{lines: []string{
+		"{\n", `  "host": "a.com",` + "\n", `  "path": "/{not a brace\"}",` + "\n", "  \"n\": {\"x\": 1}\n", "}\n",
+		"\n",
+		`{"host": "b.com"}` + "\n",
+	}}
+	got := records(t, NewFramer(src, FramerOptions{Framing: FrameJSON}))
+	want := []string{
+		"{\n" + `  "host": "a.com",` + "\n" + `  "path": "/{not a brace\"}",` + "\n" + "  \"n\": {\"x\": 1}\n" + "}\n",
+		`{"host": "b.com"}` + "\n",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFramer_PatternFlushesOnTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+	src := &lineTailer{lines: []string{"2025 first\n", "  at frame\n", "2025 second\n", "  at frame\n"}}
+	f := NewFramer(src, FramerOptions{Framing: FramePattern, Start: regexp.MustCompile(`^\d{4} `), FlushTimeout: time.Second, Clock: clk})
+
+	if got := records(t, f); len(got) != 1 || got[0] != "2025 first\n  at frame\n" {
+		t.Fatalf("got %q, want only the first record before the timeout", got)
+	}
+	clk.Advance(time.Second)
+	rec, err := f.GetRawRecord()
+	if err != nil || string(rec) != "2025 second\n  at frame\n" {
+		t.Errorf("GetRawRecord() = %q, %v, want the second record after the timeout", rec, err)
+	}
+}
+
+func TestFramer_FlushesWhenExhausted(t *testing.T) {
+	src := &lineTailer{lines: []string{"{\n", `"a": 1,` + "\n"}, exhausted: true}
+	f := NewFramer(src, FramerOptions{Framing: FrameJSON})
+	if got := records(t, f); len(got) != 1 || got[0] != "{\n\"a\": 1,\n" {
+		t.Errorf("got %q, want the unbalanced rest on exhaustion", got)
+	}
+	if _, err := f.GetRawRecord(); err != ErrExhausted {
+		t.Errorf("GetRawRecord() error = %v, want ErrExhausted", err)
+	}
+}
+
+func TestFramer_DropsOversizeRecords(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  FramerOptions
+		lines []string
+		want  []string
+	}{
+		{
+			name:  "json up to the closing brace",
+			opts:  FramerOptions{Framing: FrameJSON, MaxSize: 12},
+			lines: []string{`{"big": [` + "\n", "1, 2, 3, 4,\n", `"}", {` + "\n", "}]}\n", `{"ok": 1}` + "\n"},
+			want:  []string{`{"ok": 1}` + "\n"},
+		},
+		{
+			// the oversize record ends on the line that pushes it over
+			name:  "json completed past the limit",
+			opts:  FramerOptions{Framing: FrameJSON, MaxSize: 12},
+			lines: []string{`{"a":` + "\n", "12345678}\n", `{"ok": 1}` + "\n"},
+			want:  []string{`{"ok": 1}` + "\n"},
+		},
+		{
+			name:  "pattern up to the next start",
+			opts:  FramerOptions{Framing: FramePattern, Start: regexp.MustCompile(`^E`), MaxSize: 12},
+			lines: []string{"E big\n", "  at frame 1\n", "  at frame 2\n", "E ok\n", "  at\n", "E last\n"},
+			want:  []string{"E ok\n  at\n", "E last\n"},
+		},
+		{
+			name:  "pattern start line alone",
+			opts:  FramerOptions{Framing: FramePattern, Start: regexp.MustCompile(`^E`), MaxSize: 12},
+			lines: []string{"E a line too long\n", "E ok\n"},
+			want:  []string{"E ok\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFramer(&lineTailer{lines: tt.lines, exhausted: true}, tt.opts)
+			got := records(t, f)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("record %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if f.Oversize() != 1 {
+				t.Errorf("Oversize() = %d, want 1", f.Oversize())
+			}
+		})
+	}
+}
+
+func TestFramer_Flush(t *testing.T) {
+	src := &lineTailer{lines: []string{"{\n", `"a": 1,` + "\n"}}
+	f := NewFramer(src, FramerOptions{Framing: FrameJSON})
+	if got := records(t, f); len(got) != 0 {
+		t.Fatalf("got %q before the record ended", got)
+	}
+	if got := string(f.Flush()); got != "{\n\"a\": 1,\n" {
+		t.Errorf("Flush() = %q, want the pending lines", got)
+	}
+	if got := f.Flush(); got != nil {
+		t.Errorf("second Flush() = %q, want nothing", got)
+	}
+
+	// an oversize record being dropped stays dropped
+	src.lines = []string{"{\n", `"a": 1234567890,` + "\n"}
+	f = NewFramer(src, FramerOptions{Framing: FrameJSON, MaxSize: 12})
+	records(t, f)
+	if got := f.Flush(); got != nil {
+		t.Errorf("Flush() = %q, want nothing for a dropped record", got)
+	}
+}
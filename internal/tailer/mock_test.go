@@ -10,10 +10,11 @@ import (
 // mockFile implements file interface for testing
 type mockFile struct {
 	*bytes.Reader
-	closed    bool
-	statFunc  func() (os.FileInfo, error)
-	closeFunc func() error
-	seekFunc  func(offset int64, whence int) (int64, error)
+	closed     bool
+	statFunc   func() (os.FileInfo, error)
+	closeFunc  func() error
+	seekFunc   func(offset int64, whence int) (int64, error)
+	readAtFunc func(p []byte, off int64) (int, error)
 }
 
 func newMockFile(data []byte) *mockFile {
@@ -31,6 +32,13 @@ func (m *mockFile) Close() error {
 	return nil
 }
 
+func (m *mockFile) ReadAt(p []byte, off int64) (int, error) {
+	if m.readAtFunc != nil {
+		return m.readAtFunc(p, off)
+	}
+	return m.Reader.ReadAt(p, off)
+}
+
 func (m *mockFile) Stat() (os.FileInfo, error) {
 	if m.statFunc != nil {
 		return m.statFunc()
@@ -1,10 +1,15 @@
 package tailer
 
 import (
+	"accessAggregator/internal/clock"
 	"bufio"
+	"cmp"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"time"
 )
 
 type fileSystem interface {
@@ -26,11 +31,43 @@ type OsFS struct{}
 func (OsFS) Open(name string) (file, error)        { return os.Open(name) }
 func (OsFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
 
+// Tailer yields one raw record per GetRawRecord call. io.EOF means nothing
+// new yet and the caller should poll again, ErrExhausted means no record
+// will ever follow.
 type Tailer interface {
 	GetRawRecord() ([]byte, error)
 	Close() error
 }
 
+var ErrExhausted = errors.New("source exhausted")
+
+// bytes at the start of a file that tell it apart from its replacement,
+// unless Options.FingerprintSize says otherwise
+const fingerprintSize = 1024
+
+// Identity decides how a tailer tells whether the path still names the file
+// it has open.
+type Identity int
+
+const (
+	// device and inode numbers, see os.SameFile
+	IdentityInode Identity = iota
+	// the first FingerprintSize bytes, for overlay and network filesystems
+	// whose inode numbers are reused or unstable. Files are told apart once
+	// they hold any bytes.
+	IdentityFingerprint
+)
+
+func ParseIdentity(s string) (Identity, error) {
+	switch s {
+	case "inode":
+		return IdentityInode, nil
+	case "fingerprint":
+		return IdentityFingerprint, nil
+	}
+	return 0, fmt.Errorf("unknown file identity %q: want inode or fingerprint", s)
+}
+
 type TailFile struct {
 	fpath   string
 	file    file
@@ -38,21 +75,92 @@ type TailFile struct {
 	fstat   os.FileInfo
 	rotated bool
 	fs      fileSystem
+	log     *slog.Logger
+
+	// bytes of the file consumed so far
+	offset int64
+	// bytes consumed across every file opened, see BytesRead
+	read int64
+
+	identity Identity
+	// first bytes of the file, up to fingerprintSize
+	fingerprint     []byte
+	fingerprintSize int
+	prefix          []byte // read buffer for the first bytes, kept across checks
+	// the last read hit the end, check rotation before the next one
+	atEOF bool
+
+	maxLine  int
+	skipping bool // inside an oversize line
+	oversize int64
+
+	retry    *Retry
+	clk      clock.Clock
+	failures int       // consecutive stat or reopen failures
+	retryAt  time.Time // no reopen before
+	lastErr  error
+}
+
+type Options struct {
+	// read from the beginning instead of the end, unless Start says
+	// otherwise
+	FromStart bool
+	Start     StartPosition
+	// reads the time of a line for StartTime, false when it has none
+	TimeOf func(line []byte) (time.Time, bool)
+
+	// receives rotation and reopen events, discarded when nil
+	Logger *slog.Logger
+	// when set, a file that disappears or fails to reopen is retried with
+	// backoff instead of failing the tailer, see Err
+	Retry *Retry
+	Clock clock.Clock // defaults to clock.Real
+
+	Identity        Identity
+	FingerprintSize int // 0 for 1024 bytes
+
+	// longer lines, without the newline, are skipped and counted, see
+	// Oversize. 0 for no limit.
+	MaxLineSize int
 }
 
 func NewTailFile(fpath string, fs fileSystem, fromStart bool) (*TailFile, error) {
+	return NewTailFileWithOptions(fpath, fs, Options{FromStart: fromStart})
+}
+
+func NewTailFileWithOptions(fpath string, fs fileSystem, opts Options) (*TailFile, error) {
+	log := opts.Logger
+	if log == nil {
+		log = slog.New(slog.DiscardHandler)
+	}
+	clk := opts.Clock
+	if clk == nil {
+		clk = clock.Real{}
+	}
+
 	file, err := fs.Open(fpath)
 	if err != nil {
 		return nil, err
 	}
 
-	if !fromStart {
-		file.Seek(0, io.SeekEnd)
-	}
-
 	stat, err := file.Stat()
 	if err != nil {
+		file.Close()
 		return nil, fmt.Errorf("get file stat: %w", err)
 	}
-	return &TailFile{fpath: fpath, file: file, reader: bufio.NewReader(file), fstat: stat, fs: fs}, nil
+	offset, err := startOffset(file, stat.Size(), opts)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("find start position: %w", err)
+	}
+	if offset > 0 {
+		file.Seek(offset, io.SeekStart)
+	}
+	t := &TailFile{fpath: fpath, file: file, reader: bufio.NewReader(file), fstat: stat, fs: fs, log: log, retry: opts.Retry, clk: clk, offset: offset,
+		identity: opts.Identity, fingerprintSize: cmp.Or(opts.FingerprintSize, fingerprintSize), maxLine: opts.MaxLineSize}
+	// an offset inside a line starts at the next one
+	t.skipping = opts.Start.Kind == StartOffset && !lineStartsAt(file, offset)
+	t.matchesPrefix(file, true)
+	log.Debug("opened file", t.attrs()...)
+	return t, nil
 }
@@ -0,0 +1,22 @@
+package tailer
+
+import "time"
+
+// Retry is an exponential backoff for opening and reopening files, the
+// delay doubles from Initial up to Max.
+type Retry struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Delay is the wait before retry attempt, counting from 0.
+func (r Retry) Delay(attempt int) time.Duration {
+	d := r.Initial
+	for range attempt {
+		if d >= r.Max/2 {
+			return r.Max
+		}
+		d *= 2
+	}
+	return min(d, r.Max)
+}
@@ -0,0 +1,221 @@
+package tailer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StartKind is where a tailer starts reading a file it opens.
+type StartKind int
+
+const (
+	// the end, unless Options.FromStart
+	StartDefault StartKind = iota
+	StartEnd
+	StartBeginning
+	// StartPosition.Offset bytes in, or the next line when that is inside
+	// one
+	StartOffset
+	// the last StartPosition.Lines lines, like tail -n
+	StartLines
+	// the first line at or after StartPosition.Time, found by binary search
+	// over Options.TimeOf, so lines must be in time order
+	StartTime
+)
+
+// StartPosition is public as aggregator.StartPosition, changes must keep
+// its compatibility promise.
+type StartPosition struct {
+	Kind   StartKind
+	Offset int64
+	Lines  int
+	Time   time.Time
+}
+
+// ParseStartPosition reads end, beginning, offset:BYTES, lines:N or
+// time:RFC3339.
+func ParseStartPosition(s string) (StartPosition, error) {
+	kind, arg, _ := strings.Cut(s, ":")
+	var (
+		p   StartPosition
+		err error
+	)
+	switch kind {
+	case "end":
+		p.Kind = StartEnd
+	case "beginning":
+		p.Kind = StartBeginning
+	case "offset":
+		p.Kind = StartOffset
+		p.Offset, err = strconv.ParseInt(arg, 10, 64)
+		if err == nil && p.Offset < 0 {
+			err = fmt.Errorf("negative offset %d", p.Offset)
+		}
+	case "lines":
+		p.Kind = StartLines
+		p.Lines, err = strconv.Atoi(arg)
+		if err == nil && p.Lines < 0 {
+			err = fmt.Errorf("negative line count %d", p.Lines)
+		}
+	case "time":
+		p.Kind = StartTime
+		p.Time, err = time.Parse(time.RFC3339, arg)
+	default:
+		err = fmt.Errorf("want end, beginning, offset:BYTES, lines:N or time:RFC3339")
+	}
+	if err != nil {
+		return StartPosition{}, fmt.Errorf("invalid start position %q: %w", s, err)
+	}
+	return p, nil
+}
+
+// startOffset is where reading f of size bytes begins.
+func startOffset(f io.ReaderAt, size int64, opts Options) (int64, error) {
+	p := opts.Start
+	if p.Kind == StartDefault {
+		p.Kind = StartEnd
+		if opts.FromStart {
+			p.Kind = StartBeginning
+		}
+	}
+	switch p.Kind {
+	case StartBeginning:
+		return 0, nil
+	case StartOffset:
+		return min(p.Offset, size), nil
+	case StartLines:
+		return lastLines(f, size, p.Lines)
+	case StartTime:
+		if opts.TimeOf == nil {
+			return 0, fmt.Errorf("start by time needs Options.TimeOf")
+		}
+		return seekTime(f, size, p.Time, opts.TimeOf, opts.MaxLineSize)
+	}
+	return size, nil
+}
+
+// lineStartsAt says whether a line of f starts at off, rather than off being
+// inside one.
+func lineStartsAt(f io.ReaderAt, off int64) bool {
+	if off == 0 {
+		return true
+	}
+	b := make([]byte, 1)
+	_, err := f.ReadAt(b, off-1)
+	return err == nil && b[0] == '\n'
+}
+
+// lastLines is the offset of the n-th line from the end, reading backwards
+// in chunks. A trailing newline ends the last line rather than starting an
+// empty one.
+func lastLines(f io.ReaderAt, size int64, n int) (int64, error) {
+	if n == 0 {
+		return size, nil
+	}
+	const chunk = 4096
+	buf := make([]byte, chunk)
+	end := size
+	seen := 0
+	for end > 0 {
+		start := max(end-chunk, 0)
+		b := buf[:end-start]
+		if _, err := f.ReadAt(b, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			if seen++; seen == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// seekTime is the offset of the first line whose time is not before t.
+// Lines timeOf cannot read, or longer than maxLine, are skipped while
+// probing.
+func seekTime(f io.ReaderAt, size int64, t time.Time, timeOf func([]byte) (time.Time, bool), maxLine int) (int64, error) {
+	var readErr error
+	// the offset of the first timed line starting at or after off, and
+	// whether it is at or after t; size and true when there is none
+	probe := func(off int64) (int64, bool) {
+		skip := off > 0 // off may be mid line, the line before it ends at or after off-1
+		if skip {
+			off--
+		}
+		r := bufio.NewReader(io.NewSectionReader(f, off, size-off))
+		for {
+			line, n, err := probeLine(r, maxLine)
+			if err != nil {
+				// no line, or a last one still being written
+				if err != io.EOF {
+					readErr = err
+				}
+				return size, true
+			}
+			start := off
+			off += n
+			if skip {
+				skip = false
+				continue
+			}
+			if line == nil {
+				continue
+			}
+			if lt, ok := timeOf(bytes.TrimRight(line, "\r\n")); ok {
+				return start, !lt.Before(t)
+			}
+		}
+	}
+
+	// the first offset in [0, size] whose probe is at or after t, by hand
+	// since sort.Search takes an int, too small for files past 2GB on 32 bit
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if _, atOrAfter := probe(mid); atOrAfter {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	start, _ := probe(lo)
+	return start, readErr
+}
+
+// probeLine reads the next line of r and how many bytes it took, the line is
+// nil when longer than maxLine, 0 for no limit.
+func probeLine(r *bufio.Reader, maxLine int) ([]byte, int64, error) {
+	var (
+		line []byte
+		n    int64
+		over bool
+	)
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += int64(len(chunk))
+		if !over {
+			line = append(line, chunk...)
+			length := len(line)
+			if err == nil {
+				length-- // the newline
+			}
+			if maxLine > 0 && length > maxLine {
+				line, over = nil, true
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		return line, n, err
+	}
+}
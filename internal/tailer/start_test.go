@@ -0,0 +1,174 @@
+package tailer
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStartPosition(t *testing.T) {
+	at := time.Date(2025, 8, 14, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want StartPosition
+	}{
+		{"end", StartPosition{Kind: StartEnd}},
+		{"beginning", StartPosition{Kind: StartBeginning}},
+		{"offset:1024", StartPosition{Kind: StartOffset, Offset: 1024}},
+		{"lines:10", StartPosition{Kind: StartLines, Lines: 10}},
+		{"time:2025-08-14T09:00:00Z", StartPosition{Kind: StartTime, Time: at}},
+	}
+	for _, tt := range tests {
+		got, err := ParseStartPosition(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseStartPosition(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "middle", "offset:-1", "lines:x", "time:09:00"} {
+		if _, err := ParseStartPosition(bad); err == nil {
+			t.Errorf("ParseStartPosition(%q) expected an error", bad)
+		}
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	tests := []struct {
+		data string
+		n    int
+		want int64
+	}{
+		{"a\nbb\nccc\n", 1, 5},
+		{"a\nbb\nccc\n", 2, 2},
+		{"a\nbb\nccc\n", 5, 0},
+		{"a\nbb\nccc", 1, 5}, // last line still being written
+		{"a\nbb\n", 0, 5},
+		{strings.Repeat("x", 5000) + "\n" + strings.Repeat("y", 5000) + "\n", 1, 5001}, // across chunks
+	}
+	for _, tt := range tests {
+		got, err := lastLines(bytes.NewReader([]byte(tt.data)), int64(len(tt.data)), tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("lastLines(%.10q, %d) = %d, %v, want %d", tt.data, tt.n, got, err, tt.want)
+		}
+	}
+}
+
+func TestSeekTime(t *testing.T) {
+	epoch := time.Date(2025, 8, 14, 8, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	offsets := map[int]int64{}
+	for i := range 100 {
+		if i%7 == 3 {
+			b.WriteString("garbage\n")
+		}
+		offsets[i] = int64(b.Len())
+		fmt.Fprintf(&b, "%s some request\n", epoch.Add(time.Duration(i)*time.Minute).Format(time.RFC3339))
+	}
+	data := b.String()
+	timeOf := func(line []byte) (time.Time, bool) {
+		ts, _, _ := strings.Cut(string(line), " ")
+		t, err := time.Parse(time.RFC3339, ts)
+		return t, err == nil
+	}
+
+	tests := []struct {
+		at   time.Time
+		want int64
+	}{
+		{epoch.Add(-time.Hour), 0},
+		{epoch.Add(30 * time.Minute), offsets[30]},
+		{epoch.Add(30*time.Minute + time.Second), offsets[31]},
+		{epoch.Add(time.Hour), offsets[60]},
+		{epoch.Add(24 * time.Hour), int64(len(data))},
+	}
+	for _, tt := range tests {
+		got, err := seekTime(strings.NewReader(data), int64(len(data)), tt.at, timeOf, 0)
+		if err != nil {
+			t.Fatalf("seekTime() error = %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("seekTime(%v) = %d, want %d", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestSeekTime_SkipsOversizeLines(t *testing.T) {
+	epoch := time.Date(2025, 8, 14, 8, 0, 0, 0, time.UTC)
+	huge := epoch.Format(time.RFC3339) + " " + strings.Repeat("x", 10000) + "\n"
+	later := epoch.Add(time.Minute).Format(time.RFC3339) + " ok\n"
+	data := huge + later
+	timeOf := func(line []byte) (time.Time, bool) {
+		ts, _, _ := strings.Cut(string(line), " ")
+		t, err := time.Parse(time.RFC3339, ts)
+		return t, err == nil
+	}
+
+	got, err := seekTime(strings.NewReader(data), int64(len(data)), epoch, timeOf, 100)
+	if err != nil || got != int64(len(huge)) {
+		t.Errorf("seekTime() = %d, %v, want %d", got, err, len(huge))
+	}
+}
+
+// sparseLog is a log of fixed width lines, line i timed i seconds after
+// epoch, without holding its bytes
+type sparseLog struct{ epoch time.Time }
+
+const sparseLine = 32
+
+func (l sparseLog) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		n := (off + int64(i)) / sparseLine
+		line := fmt.Sprintf("%-31d\n", n)
+		p[i] = line[(off+int64(i))%sparseLine]
+	}
+	return len(p), nil
+}
+
+func TestSeekTime_PastInt32(t *testing.T) {
+	epoch := time.Date(2025, 8, 14, 8, 0, 0, 0, time.UTC)
+	timeOf := func(line []byte) (time.Time, bool) {
+		n, err := strconv.ParseInt(strings.TrimSpace(string(line)), 10, 64)
+		return epoch.Add(time.Duration(n) * time.Second), err == nil
+	}
+	const size = 1 << 33
+	line := int64(math.MaxInt32/sparseLine + 1000)
+
+	got, err := seekTime(sparseLog{epoch}, size, epoch.Add(time.Duration(line)*time.Second), timeOf, 0)
+	if err != nil || got != line*sparseLine {
+		t.Errorf("seekTime() = %d, %v, want %d", got, err, line*sparseLine)
+	}
+}
+
+func TestNewTailFile_StartOffsetMidLine(t *testing.T) {
+	for off, want := range map[int64]string{4: "two\n", 5: "three\n", 0: "one\n"} {
+		fs := newMockFileSystem()
+		fs.files["test.log"] = newMockFile([]byte("one\ntwo\nthree\n"))
+		tailer, err := NewTailFileWithOptions("test.log", fs, Options{Start: StartPosition{Kind: StartOffset, Offset: off}})
+		if err != nil {
+			t.Fatalf("Failed to create tailer: %v", err)
+		}
+		if line, err := tailer.GetRawRecord(); err != nil || string(line) != want {
+			t.Errorf("offset %d: GetRawRecord() = %q, %v, want %q", off, line, err, want)
+		}
+		tailer.Close()
+	}
+}
+
+func TestNewTailFile_StartLines(t *testing.T) {
+	fs := newMockFileSystem()
+	fs.files["test.log"] = newMockFile([]byte("one\ntwo\nthree\n"))
+
+	tailer, err := NewTailFileWithOptions("test.log", fs, Options{Start: StartPosition{Kind: StartLines, Lines: 2}})
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+	for _, want := range []string{"two\n", "three\n"} {
+		if line, err := tailer.GetRawRecord(); err != nil || string(line) != want {
+			t.Errorf("GetRawRecord() = %q, %v, want %q", line, err, want)
+		}
+	}
+}
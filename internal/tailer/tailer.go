@@ -1,21 +1,31 @@
 package tailer
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"time"
 )
 
 func (t *TailFile) Close() error {
 	return t.file.Close()
 }
 
+// GetRawRecord checks for rotation when resuming after io.EOF, right before
+// reading what was appended, so a copytruncate is never read at the old
+// offset.
 func (t *TailFile) GetRawRecord() ([]byte, error) {
-	line, err := t.reader.ReadBytes('\n')
-	if err == io.EOF {
+	if t.atEOF {
+		t.atEOF = false
 		if err := t.checkRotation(); err != nil {
 			return nil, fmt.Errorf("detect rotation: %w", err)
 		}
+	}
+	line, err := t.readLine()
+	if err == io.EOF {
+		t.atEOF = true
 		return nil, io.EOF
 	}
 	if err != nil {
@@ -24,6 +34,56 @@ func (t *TailFile) GetRawRecord() ([]byte, error) {
 	return line, nil
 }
 
+// readLine is reader.ReadBytes('\n') holding at most maxLine bytes: longer
+// lines are discarded up to their newline, across calls when they end past
+// the current EOF, and counted.
+func (t *TailFile) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := t.reader.ReadSlice('\n')
+		t.offset += int64(len(chunk))
+		t.read += int64(len(chunk))
+
+		n := len(line) + len(chunk)
+		if err == nil {
+			n-- // the newline
+		}
+		switch {
+		case t.skipping:
+		case t.maxLine > 0 && n > t.maxLine:
+			t.skipping = true
+			t.oversize++
+			t.log.Warn("skipping oversize line", append(t.attrs(), "max_bytes", t.maxLine)...)
+			line = nil
+		default:
+			line = append(line, chunk...)
+		}
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return line, err
+		}
+		if t.skipping {
+			t.skipping = false
+			continue
+		}
+		return line, nil
+	}
+}
+
+// Oversize is how many lines longer than Options.MaxLineSize were skipped.
+func (t *TailFile) Oversize() int64 {
+	return t.oversize
+}
+
+// BytesRead is how many bytes were consumed, skipped lines included, over
+// every file followed.
+func (t *TailFile) BytesRead() int64 {
+	return t.read
+}
+
 type rotationStatus int
 
 const (
@@ -34,42 +94,162 @@ const (
 
 var sameFile = os.SameFile
 
-func whichRotation(lastStat, currStat os.FileInfo) rotationStatus {
-	if sameFile(lastStat, currStat) {
-		if currStat.Size() < lastStat.Size() {
-			return truncated
+// whichRotation compares the file at the path with the open one. Sizes are
+// checked against our own read offset and the first bytes against the
+// fingerprint, so a copytruncate refilled past the old size is still seen
+// as a truncation, and a different file reusing the inode as a rename. The
+// first bytes are only read again once the path changed since the last
+// check, and the path only reopened when it may name another file.
+func (t *TailFile) whichRotation(currStat os.FileInfo) rotationStatus {
+	size := currStat.Size()
+	// the size of the open file, the path may name another one
+	openSize := int64(-1)
+	if st, err := t.file.Stat(); err == nil {
+		openSize = st.Size()
+	}
+	moved := !sameFile(t.fstat, currStat)
+	switch t.identity {
+	case IdentityInode:
+		if moved {
+			return renamed
+		}
+	case IdentityFingerprint:
+		if openSize >= 0 {
+			size = openSize
+		}
+	}
+	if size < t.offset {
+		return truncated
+	}
+	if !moved && currStat.Size() == t.fstat.Size() && currStat.ModTime().Equal(t.fstat.ModTime()) {
+		return same // nothing written since the last check
+	}
+	if !t.matchesPrefix(t.file, true) {
+		return truncated
+	}
+	// a reused inode shows as the same file holding another size
+	if moved || (openSize >= 0 && openSize != currStat.Size()) {
+		if f, err := t.fs.Open(t.fpath); err == nil {
+			defer f.Close()
+			if !t.matchesPrefix(f, false) {
+				return renamed
+			}
 		}
-		return same
 	}
-	return renamed
+	return same
+}
+
+// matchesPrefix reports whether f starts with the fingerprint. With grow,
+// a fingerprint shorter than the fingerprint size is extended by what f
+// holds now.
+func (t *TailFile) matchesPrefix(f file, grow bool) bool {
+	if t.prefix == nil {
+		t.prefix = make([]byte, t.fingerprintSize)
+	}
+	n, err := f.ReadAt(t.prefix, 0)
+	if err != nil && err != io.EOF {
+		return true // unknown, rely on size and identity
+	}
+	if n < len(t.fingerprint) || !bytes.Equal(t.prefix[:len(t.fingerprint)], t.fingerprint) {
+		return false
+	}
+	if grow {
+		t.fingerprint = append(t.fingerprint[:0], t.prefix[:n]...)
+	}
+	return true
 }
 
 func (t *TailFile) checkRotation() error {
+	// backing off after a stat or reopen failure
+	if t.retry != nil && t.clk.Now().Before(t.retryAt) {
+		return nil
+	}
 	currStat, err := t.fs.Stat(t.fpath)
 	if err != nil {
+		if t.retry != nil {
+			t.fail("stat failed", err)
+		} else {
+			t.log.Debug("stat failed", append(t.attrs(), "err", err)...)
+		}
 		return nil // dont break the loop
 	}
 
-	switch whichRotation(t.fstat, currStat) {
+	switch t.whichRotation(currStat) {
+	case same:
+		t.fstat = currStat
+		t.recover()
 	case truncated:
+		t.log.Info("file truncated", append(t.attrs(), "size", currStat.Size())...)
 		t.file.Seek(0, io.SeekStart)
 		t.reader.Reset(t.file)
 		t.fstat = currStat
+		t.offset = 0
+		t.skipping = false // the oversize line went with the old content
+		t.fingerprint = t.fingerprint[:0]
+		t.matchesPrefix(t.file, true)
+		t.recover()
 	case renamed:
 		if t.rotated {
-			t.file.Close()
 			newFile, err := t.fs.Open(t.fpath)
 			if err != nil {
+				if t.retry != nil {
+					t.fail("reopen failed", err)
+					return nil
+				}
+				t.log.Error("reopen failed", append(t.attrs(), "err", err)...)
 				return fmt.Errorf("reopen file: %w", err)
 			}
+			t.file.Close()
 			t.file = newFile
 			t.reader.Reset(newFile)
 			t.fstat = currStat
+			t.offset = 0
+			t.skipping = false
+			t.fingerprint = t.fingerprint[:0]
+			t.matchesPrefix(newFile, true)
+			t.log.Info("reopened file", t.attrs()...)
+			t.recover()
 
 			t.rotated = false
+		} else {
+			t.log.Info("file rotated", append(t.attrs(), "new_inode", inode(currStat))...)
 		}
 		// first, just mark rotation, let it drain old file
 		t.rotated = true
 	}
 	return nil
 }
+
+// Err is the last stat or reopen failure while retrying, nil once the file
+// is readable again. Always nil without Options.Retry.
+func (t *TailFile) Err() error {
+	return t.lastErr
+}
+
+// fail records a failure to retry and backs off before the next attempt,
+// only the first of a streak is a warning
+func (t *TailFile) fail(msg string, err error) {
+	attrs := append(t.attrs(), "err", err, "attempt", t.failures+1)
+	if t.failures == 0 {
+		t.log.Warn(msg, attrs...)
+	} else {
+		t.log.Debug(msg, attrs...)
+	}
+	t.failures++
+	t.lastErr = err
+	t.retryAt = t.clk.Now().Add(t.retry.Delay(t.failures - 1))
+}
+
+func (t *TailFile) recover() {
+	if t.lastErr != nil {
+		t.log.Info("file recovered", append(t.attrs(), "attempts", t.failures)...)
+	}
+	t.failures = 0
+	t.retryAt = time.Time{}
+	t.lastErr = nil
+}
+
+// attrs are the log fields identifying the file and the read position.
+func (t *TailFile) attrs() []any {
+	return []any{"path", t.fpath, "inode", inode(t.fstat), "offset", t.offset}
+}
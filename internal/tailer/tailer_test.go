@@ -1,10 +1,17 @@
 package tailer
 
 import (
+	"accessAggregator/internal/clock"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewTailFile(t *testing.T) {
@@ -304,3 +311,335 @@ func TestErrorScenarios(t *testing.T) {
 		}
 	})
 }
+
+func TestCheckRotation_Logs(t *testing.T) {
+	fs := newMockFileSystem()
+	initialFile := newMockFile([]byte("line1\nline2\n"))
+	initialFile.statFunc = func() (os.FileInfo, error) {
+		return &mockFileInfo{name: "test.log", size: 12}, nil
+	}
+	fs.files["test.log"] = initialFile
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&buf, nil))
+	tailer, err := NewTailFileWithOptions("test.log", fs, Options{FromStart: true, Logger: log})
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+	tailer.GetRawRecord()
+
+	fs.statFunc = func(name string) (os.FileInfo, error) {
+		return &mockFileInfo{name: "test.log", size: 5}, nil
+	}
+	originalSameFile := sameFile
+	sameFile = func(fi1, fi2 os.FileInfo) bool { return true }
+	defer func() { sameFile = originalSameFile }()
+
+	if err := tailer.checkRotation(); err != nil {
+		t.Fatalf("checkRotation() unexpected error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("expected one JSON log line, got %q: %v", buf.String(), err)
+	}
+	for k, want := range map[string]any{"msg": "file truncated", "path": "test.log", "offset": 6.0, "size": 5.0} {
+		if got[k] != want {
+			t.Errorf("%s = %v, want %v", k, got[k], want)
+		}
+	}
+	if _, ok := got["inode"]; !ok {
+		t.Error("expected an inode field")
+	}
+}
+
+func TestRetry_Delay(t *testing.T) {
+	r := Retry{Initial: time.Second, Max: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempt, w := range want {
+		if got := r.Delay(attempt); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, w)
+		}
+	}
+}
+
+func TestCheckRotation_RetriesReopen(t *testing.T) {
+	fs := newMockFileSystem()
+	fs.files["test.log"] = newMockFile([]byte("old\n"))
+	clk := clock.NewFake(time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC))
+
+	tailer, err := NewTailFileWithOptions("test.log", fs, Options{FromStart: true, Retry: &Retry{Initial: time.Second, Max: time.Minute}, Clock: clk})
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+
+	originalSameFile := sameFile
+	sameFile = func(fi1, fi2 os.FileInfo) bool { return false }
+	defer func() { sameFile = originalSameFile }()
+
+	// the file disappears
+	stats := 0
+	fs.statFunc = func(name string) (os.FileInfo, error) {
+		stats++
+		return nil, os.ErrNotExist
+	}
+	if err := tailer.checkRotation(); err != nil {
+		t.Fatalf("checkRotation() unexpected error: %v", err)
+	}
+	if !errors.Is(tailer.Err(), os.ErrNotExist) {
+		t.Fatalf("Err() = %v, want ErrNotExist", tailer.Err())
+	}
+	tailer.checkRotation()
+	if stats != 1 {
+		t.Fatalf("expected no stat before the backoff, got %d stats", stats)
+	}
+
+	// a new file shows up but cannot be opened yet
+	clk.Advance(time.Second)
+	fs.statFunc = func(name string) (os.FileInfo, error) { return &mockFileInfo{name: "test.log", size: 4}, nil }
+	opens := 0
+	fs.openFunc = func(name string) (file, error) {
+		opens++
+		if opens == 1 {
+			return nil, os.ErrPermission
+		}
+		return newMockFile([]byte("new\n")), nil
+	}
+	tailer.checkRotation() // marks rotation
+	if err := tailer.checkRotation(); err != nil {
+		t.Fatalf("checkRotation() unexpected error: %v", err)
+	}
+	if !errors.Is(tailer.Err(), os.ErrPermission) {
+		t.Fatalf("Err() = %v, want ErrPermission", tailer.Err())
+	}
+
+	// backing off
+	tailer.checkRotation()
+	if opens != 1 {
+		t.Fatalf("expected no reopen before the backoff, got %d opens", opens)
+	}
+
+	// second failure of the streak, after the stat one
+	clk.Advance(2 * time.Second)
+	tailer.checkRotation()
+	if tailer.Err() != nil {
+		t.Fatalf("Err() = %v after reopening", tailer.Err())
+	}
+	if line, err := tailer.GetRawRecord(); string(line) != "new\n" {
+		t.Errorf("GetRawRecord() = %q, %v, want the new file", line, err)
+	}
+}
+
+func TestGetRawRecord_CopytruncateRefilledPastOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("old1\nold2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tailer, err := NewTailFile(path, OsFS{}, true)
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+	// drained up to EOF, like a tailer waiting for more
+	for range 3 {
+		tailer.GetRawRecord()
+	}
+
+	// copytruncate, then more is written than was there before
+	if err := os.WriteFile(path, []byte("new1 longer than before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	line, err := tailer.GetRawRecord()
+	if err != nil || string(line) != "new1 longer than before\n" {
+		t.Errorf("GetRawRecord() = %q, %v, want the refilled file from the start", line, err)
+	}
+}
+
+func TestCheckRotation_SameInodeDifferentFile(t *testing.T) {
+	fs := newMockFileSystem()
+	fs.files["test.log"] = newMockFile([]byte("old\n"))
+
+	tailer, err := NewTailFile("test.log", fs, true)
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+	tailer.GetRawRecord()
+
+	originalSameFile := sameFile
+	sameFile = func(fi1, fi2 os.FileInfo) bool { return true }
+	defer func() { sameFile = originalSameFile }()
+
+	// the path now holds another file the filesystem reports as the same
+	replacement := newMockFile([]byte("other\n"))
+	fs.files["test.log"] = replacement
+	if got := tailer.whichRotation(&mockFileInfo{name: "test.log", size: 6}); got != renamed {
+		t.Errorf("whichRotation() = %v, want renamed", got)
+	}
+}
+
+func TestWhichRotation_FingerprintIdentity(t *testing.T) {
+	tests := []struct {
+		name     string
+		sameFile bool
+		pathData string
+		want     rotationStatus
+	}{
+		{"inode changed, same content", false, "line1\nline2\n", same},
+		{"inode reused, other content", true, "other file\n", renamed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newMockFileSystem()
+			open := newMockFile([]byte("line1\n"))
+			open.statFunc = func() (os.FileInfo, error) {
+				return &mockFileInfo{name: "test.log", size: 6}, nil
+			}
+			fs.files["test.log"] = open
+
+			tailer, err := NewTailFileWithOptions("test.log", fs, Options{FromStart: true, Identity: IdentityFingerprint, FingerprintSize: 5})
+			if err != nil {
+				t.Fatalf("Failed to create tailer: %v", err)
+			}
+			defer tailer.Close()
+			tailer.GetRawRecord()
+
+			originalSameFile := sameFile
+			sameFile = func(fi1, fi2 os.FileInfo) bool { return tt.sameFile }
+			defer func() { sameFile = originalSameFile }()
+
+			fs.files["test.log"] = newMockFile([]byte(tt.pathData))
+			if got := tailer.whichRotation(&mockFileInfo{name: "test.log", size: int64(len(tt.pathData))}); got != tt.want {
+				t.Errorf("whichRotation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhichRotation_ReadsOnlyOnChange(t *testing.T) {
+	fs := newMockFileSystem()
+	f := newMockFile([]byte("line1\n"))
+	info := &mockFileInfo{name: "test.log", size: 6}
+	f.statFunc = func() (os.FileInfo, error) { return info, nil }
+	reads := 0
+	f.readAtFunc = func(p []byte, off int64) (int, error) {
+		reads++
+		return f.Reader.ReadAt(p, off)
+	}
+	fs.files["test.log"] = f
+	opens := 0
+	fs.openFunc = func(name string) (file, error) {
+		opens++
+		return fs.files[name], nil
+	}
+
+	tailer, err := NewTailFile("test.log", fs, true)
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+	tailer.GetRawRecord()
+
+	originalSameFile := sameFile
+	sameFile = func(fi1, fi2 os.FileInfo) bool { return true }
+	defer func() { sameFile = originalSameFile }()
+
+	reads, opens = 0, 0
+	for range 3 {
+		if got := tailer.whichRotation(info); got != same {
+			t.Fatalf("whichRotation() = %v, want same", got)
+		}
+	}
+	if reads != 0 || opens != 0 {
+		t.Errorf("idle checks read the prefix %d times and reopened %d times, want neither", reads, opens)
+	}
+
+	// appended to: the prefix is read again, the path names the open file
+	info = &mockFileInfo{name: "test.log", size: 12}
+	if got := tailer.whichRotation(info); got != same {
+		t.Fatalf("whichRotation() = %v, want same", got)
+	}
+	if reads != 1 || opens != 0 {
+		t.Errorf("check after a write read the prefix %d times and reopened %d times, want 1 and 0", reads, opens)
+	}
+}
+
+func TestGetRawRecord_SkipsOversizeLines(t *testing.T) {
+	huge := strings.Repeat("x", 10000) // past the bufio buffer
+	fs := newMockFileSystem()
+	fs.files["test.log"] = newMockFile([]byte("ok\n" + huge + "\n12345\n123456\nok2\n"))
+
+	tailer, err := NewTailFileWithOptions("test.log", fs, Options{FromStart: true, MaxLineSize: 5})
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+
+	for _, want := range []string{"ok\n", "12345\n", "ok2\n"} {
+		line, err := tailer.GetRawRecord()
+		if err != nil || string(line) != want {
+			t.Fatalf("GetRawRecord() = %q, %v, want %q", line, err, want)
+		}
+	}
+	if got := tailer.Oversize(); got != 2 {
+		t.Errorf("Oversize() = %d, want 2", got)
+	}
+	// skipped lines count as read
+	if got, want := tailer.BytesRead(), int64(len(huge)+len("ok\n\n12345\n123456\nok2\n")); got != want {
+		t.Errorf("BytesRead() = %d, want %d", got, want)
+	}
+}
+
+func TestGetRawRecord_SkipsOversizeLineAcrossEOF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tailer, err := NewTailFileWithOptions(path, OsFS{}, Options{FromStart: true, MaxLineSize: 8})
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+
+	f.WriteString("a stack trace that")
+	if _, err := tailer.GetRawRecord(); err != io.EOF {
+		t.Fatalf("GetRawRecord() error = %v, want EOF", err)
+	}
+	f.WriteString(" goes on and on\nok\n")
+	line, err := tailer.GetRawRecord()
+	if err != nil || string(line) != "ok\n" {
+		t.Errorf("GetRawRecord() = %q, %v, want the line after the oversize one", line, err)
+	}
+	if got := tailer.Oversize(); got != 1 {
+		t.Errorf("Oversize() = %d, want 1", got)
+	}
+}
+
+func TestGetRawRecord_OversizeLineEndsWithTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := os.WriteFile(path, []byte("a partial line too long"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tailer, err := NewTailFileWithOptions(path, OsFS{}, Options{FromStart: true, MaxLineSize: 8})
+	if err != nil {
+		t.Fatalf("Failed to create tailer: %v", err)
+	}
+	defer tailer.Close()
+	if _, err := tailer.GetRawRecord(); err != io.EOF {
+		t.Fatalf("GetRawRecord() error = %v, want EOF", err)
+	}
+
+	// copytruncate before the oversize line ended
+	if err := os.WriteFile(path, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	line, err := tailer.GetRawRecord()
+	if err != nil || string(line) != "new\n" {
+		t.Errorf("GetRawRecord() = %q, %v, want the first line of the new content", line, err)
+	}
+}
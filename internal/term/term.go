@@ -0,0 +1,8 @@
+// Package term detects terminals and switches them to raw input, with the
+// few ioctls the dashboard needs instead of a dependency.
+package term
+
+// Size is the terminal size in character cells.
+type Size struct {
+	Cols, Rows int
+}
@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package term
+
+import "errors"
+
+var errUnsupported = errors.New("terminal control not supported on this platform")
+
+// IsTerminal always reports false, output is treated as a pipe.
+func IsTerminal(fd uintptr) bool { return false }
+
+func MakeRaw(fd uintptr) (restore func() error, err error) { return nil, errUnsupported }
+
+func GetSize(fd uintptr) (Size, error) { return Size{}, errUnsupported }
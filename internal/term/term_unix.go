@@ -0,0 +1,50 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package term
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// IsTerminal reports whether fd refers to a terminal.
+func IsTerminal(fd uintptr) bool {
+	var t syscall.Termios
+	return ioctl(fd, ioctlGetTermios, unsafe.Pointer(&t)) == nil
+}
+
+// MakeRaw turns off line buffering and echo on fd, so single key presses
+// can be read, and returns a function restoring the previous state. A read
+// returns nothing after a tenth of a second without a key press, so a
+// reader can check whether to stop. Output processing is kept, so "\n"
+// still starts a new line.
+func MakeRaw(fd uintptr) (restore func() error, err error) {
+	var old syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1 // tenths of a second
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() error { return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&old)) }, nil
+}
+
+// GetSize returns the size of the terminal fd refers to.
+func GetSize(fd uintptr) (Size, error) {
+	var ws struct{ Row, Col, Xpixel, Ypixel uint16 }
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return Size{}, err
+	}
+	return Size{Cols: int(ws.Col), Rows: int(ws.Row)}, nil
+}
@@ -0,0 +1,393 @@
+// Package tui is the -tui dashboard: the summary table redrawn in place,
+// sortable, filterable and with a request rate sparkline per host.
+package tui
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/sink"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// ticks of request rate kept per host for the sparkline
+	historyLen = 20
+
+	enterAltScreen = "\033[?1049h\033[?25l"
+	exitAltScreen  = "\033[?25h\033[?1049l"
+	home           = "\033[H"
+	clearLine      = "\033[K"
+	clearBelow     = "\033[J"
+	inverse        = "\033[7m"
+	reset          = "\033[0m"
+)
+
+type column struct {
+	name  string // as in View.Columns
+	title string
+	width int
+	less  func(a, b accesslog.Row) bool
+	value func(r accesslog.Row) string
+}
+
+var hostColumn = column{"host", "host", 0, func(a, b accesslog.Row) bool { return a.Host < b.Host }, nil}
+
+// what View.Columns can pick from, the first four are the default
+var columns = []column{
+	{"total", "total", 10, func(a, b accesslog.Row) bool { return a.Requests < b.Requests },
+		func(r accesslog.Row) string { return strconv.Itoa(r.Requests) }},
+	{"2xx", "2xx", 10, func(a, b accesslog.Row) bool { return a.Requests2xx < b.Requests2xx },
+		func(r accesslog.Row) string { return strconv.Itoa(r.Requests2xx) }},
+	{"non_2xx", "non_2xx", 10, func(a, b accesslog.Row) bool { return a.Requests-a.Requests2xx < b.Requests-b.Requests2xx },
+		func(r accesslog.Row) string { return strconv.Itoa(r.Requests - r.Requests2xx) }},
+	{"avg_duration", "avg_s", 9, func(a, b accesslog.Row) bool { return a.AvgDuration() < b.AvgDuration() },
+		func(r accesslog.Row) string { return strconv.FormatFloat(r.AvgDuration(), 'f', 3, 64) }},
+	{"5xx", "5xx", 10, func(a, b accesslog.Row) bool { return a.ByClass[5] < b.ByClass[5] },
+		func(r accesslog.Row) string { return strconv.Itoa(r.ByClass[5]) }},
+	{"error_ratio", "err_ratio", 9, func(a, b accesslog.Row) bool { return a.ErrorRatio() < b.ErrorRatio() },
+		func(r accesslog.Row) string { return strconv.FormatFloat(r.ErrorRatio(), 'f', 4, 64) }},
+	{"uniq", "uniq", 10, func(a, b accesslog.Row) bool { return a.Distinct < b.Distinct },
+		func(r accesslog.Row) string { return strconv.FormatUint(r.Distinct, 10) }},
+}
+
+// the column each View.Sort orders by
+var sortColumns = map[accesslog.SortKey]string{
+	accesslog.SortHost:        "host",
+	accesslog.SortTotal:       "total",
+	accesslog.SortErrors:      "5xx",
+	accesslog.SortErrorRatio:  "error_ratio",
+	accesslog.SortAvgDuration: "avg_duration",
+}
+
+func columnNamed(name string) column {
+	if name == hostColumn.name {
+		return hostColumn
+	}
+	return columns[slices.IndexFunc(columns, func(c column) bool { return c.name == name })]
+}
+
+// Dashboard holds the view state. Update is called from the aggregator and
+// Key from the keyboard reader, both redraw.
+type Dashboard struct {
+	mu   sync.Mutex
+	out  io.Writer
+	size func() (cols, rows int)
+
+	snap    sink.Snapshot // latest
+	shown   sink.Snapshot // on screen, frozen while paused
+	last    map[string]int
+	history map[string][]int
+
+	// the host and View columns, selected with keys 1 to 9
+	cols []column
+	top  int
+	// the column sorted by, which may be one the View hides
+	sortBy  column
+	desc    bool
+	filter  string
+	editing bool // typing a filter
+	paused  bool
+
+	// latest diagnostic line, shown in the status bar instead of being
+	// written over the screen
+	lastErr string
+}
+
+// New draws on out, size reports the terminal size for each redraw. view
+// picks the columns, the first order and the hosts shown, like it does for
+// the other outputs.
+func New(out io.Writer, size func() (cols, rows int), view accesslog.View) *Dashboard {
+	d := &Dashboard{out: out, size: size, last: make(map[string]int), history: make(map[string][]int),
+		cols: []column{hostColumn}, top: view.Top, sortBy: columnNamed(sortColumns[view.Sort]), desc: view.Desc}
+	names := view.Columns
+	if names == nil {
+		names = []string{"total", "2xx", "non_2xx", "avg_duration"}
+	}
+	for _, name := range names {
+		d.cols = append(d.cols, columnNamed(name))
+	}
+	return d
+}
+
+// Start switches to the alternate screen, Stop restores the terminal.
+func (d *Dashboard) Start() { fmt.Fprint(d.out, enterAltScreen) }
+func (d *Dashboard) Stop()  { fmt.Fprint(d.out, exitAltScreen) }
+
+func (d *Dashboard) Update(snap sink.Snapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	seen := make(map[string]bool, len(snap.Rows))
+	for _, r := range snap.Rows {
+		seen[r.Host] = true
+		delta := r.Requests - d.last[r.Host]
+		if delta < 0 { // evicted and seen again
+			delta = r.Requests
+		}
+		d.last[r.Host] = r.Requests
+		h := append(d.history[r.Host], delta)
+		if len(h) > historyLen {
+			h = h[len(h)-historyLen:]
+		}
+		d.history[r.Host] = h
+	}
+	// hosts evicted by -max-groups start over if they come back
+	for host := range d.last {
+		if !seen[host] {
+			delete(d.last, host)
+			delete(d.history, host)
+		}
+	}
+
+	d.snap = snap
+	if !d.paused {
+		d.shown = snap
+	}
+	d.drawLocked()
+}
+
+// SetError shows msg in the status bar until the next one.
+func (d *Dashboard) SetError(msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastErr = msg
+	d.drawLocked()
+}
+
+// Key handles one key press and reports whether the user asked to quit.
+func (d *Dashboard) Key(k byte) (quit bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.editing {
+		switch k {
+		case '\r', '\n':
+			d.editing = false
+		case 27: // escape
+			d.editing, d.filter = false, ""
+		case 127, 8: // backspace
+			if d.filter != "" {
+				d.filter = d.filter[:len(d.filter)-1]
+			}
+		default:
+			if k >= ' ' && k < 127 {
+				d.filter += string(k)
+			}
+		}
+		d.drawLocked()
+		return false
+	}
+
+	switch k {
+	case 'q':
+		return true
+	case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		i := int(k - '1')
+		if i >= len(d.cols) {
+			break
+		}
+		if col := d.cols[i]; col.name == d.sortBy.name {
+			d.desc = !d.desc
+		} else {
+			// names read best A to Z, numbers largest first
+			d.sortBy, d.desc = col, i != 0
+		}
+	case '/':
+		d.editing, d.filter = true, ""
+	case 27:
+		d.filter = ""
+	case 'p', ' ':
+		d.paused = !d.paused
+		if !d.paused {
+			d.shown = d.snap
+		}
+	}
+	d.drawLocked()
+	return false
+}
+
+func (d *Dashboard) drawLocked() {
+	cols, rows := d.size()
+	io.WriteString(d.out, d.render(cols, rows))
+}
+
+// render builds one full frame for a cols x rows terminal
+func (d *Dashboard) render(cols, rows int) string {
+	rowsShown := d.rows()
+	hostWidth := len("host")
+	for _, r := range rowsShown {
+		hostWidth = max(hostWidth, utf8.RuneCountInString(r.Host))
+	}
+	hostWidth = min(hostWidth, max(cols/3, 10))
+
+	// every line is cut to cols, a wrapped line would scroll the frame;
+	// bars are drawn inverse across the screen
+	var lines []string
+	bars := map[int]bool{}
+	state := "live"
+	if d.paused {
+		state = "PAUSED"
+	}
+	lines = append(lines, fmt.Sprintf("access log summary as of %s  [%s]  %d hosts",
+		d.shown.Time.Format("2006-01-02 15:04:05"), state, len(d.shown.Rows)))
+
+	var header strings.Builder
+	for i, c := range d.cols {
+		title := c.title
+		if c.name == d.sortBy.name {
+			title += map[bool]string{true: "▼", false: "▲"}[d.desc]
+		}
+		if i == 0 {
+			fmt.Fprintf(&header, "%-*s", hostWidth+1, title)
+		} else {
+			fmt.Fprintf(&header, " %*s", c.width, title)
+		}
+	}
+	header.WriteString("  rate")
+	bars[len(lines)] = true
+	lines = append(lines, header.String())
+
+	// title, header, filter and two status lines
+	room := max(rows-5, 1)
+	for i, r := range rowsShown {
+		if i == room-1 && len(rowsShown) > room {
+			lines = append(lines, fmt.Sprintf("... %d more hosts", len(rowsShown)-i))
+			break
+		}
+		var line strings.Builder
+		fmt.Fprintf(&line, "%-*s", hostWidth, truncate(r.Host, hostWidth))
+		for _, c := range d.cols[1:] {
+			fmt.Fprintf(&line, " %*s", c.width, c.value(r))
+		}
+		line.WriteString("  " + sparkline(d.history[r.Host]))
+		lines = append(lines, line.String())
+	}
+	for len(lines) < rows-3 {
+		lines = append(lines, "")
+	}
+
+	filter := "/ to filter hosts"
+	switch {
+	case d.editing:
+		filter = "filter: " + d.filter + "█"
+	case d.filter != "":
+		filter = "filter: " + d.filter + "  (esc to clear)"
+	}
+	lines = append(lines, filter)
+	bars[len(lines)] = true
+	lines = append(lines, d.inputStatus())
+	lines = append(lines, fmt.Sprintf("1-%d sort (again to reverse)  / filter  p pause  q quit", len(d.cols)))
+
+	var b strings.Builder
+	b.WriteString(home)
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		l = truncate(l, cols)
+		if bars[i] {
+			l = inverse + pad(l, cols) + reset
+		}
+		b.WriteString(l + clearLine)
+	}
+	b.WriteString(clearBelow)
+	return b.String()
+}
+
+// rows returns the shown rows that pass the filter, in the selected order
+// and cut to the View's top
+func (d *Dashboard) rows() []accesslog.Row {
+	var rows []accesslog.Row
+	for _, r := range d.shown.Rows {
+		if strings.Contains(r.Host, d.filter) {
+			rows = append(rows, r)
+		}
+	}
+	less := d.sortBy.less
+	slices.SortStableFunc(rows, func(a, b accesslog.Row) int {
+		x, y := a, b
+		if d.desc {
+			x, y = b, a
+		}
+		switch {
+		case less(x, y):
+			return -1
+		case less(y, x):
+			return 1
+		}
+		// ties stay A to Z either way
+		return strings.Compare(a.Host, b.Host)
+	})
+	return accesslog.View{Top: d.top}.CutTop(rows)
+}
+
+func (d *Dashboard) inputStatus() string {
+	var parts []string
+	for _, in := range d.snap.Inputs {
+		s := in.Name
+		if in.State != "" {
+			s += " " + in.State
+		}
+		if in.Dropped > 0 {
+			s += fmt.Sprintf(" dropped %d", in.Dropped)
+		}
+		if in.Blocked > 0 {
+			s += fmt.Sprintf(" blocked %v", in.Blocked.Round(time.Millisecond))
+		}
+		if in.Throttling {
+			s += " throttled"
+		}
+		if in.Oversize > 0 {
+			s += fmt.Sprintf(" oversize %d", in.Oversize)
+		}
+		parts = append(parts, s)
+	}
+	if d.snap.Malformed > 0 {
+		parts = append(parts, fmt.Sprintf("malformed %d", d.snap.Malformed))
+	}
+	if d.lastErr != "" {
+		parts = append(parts, d.lastErr)
+	}
+	return strings.Join(parts, " | ")
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws counts scaled to their maximum, oldest first
+func sparkline(counts []int) string {
+	peak := 0
+	for _, c := range counts {
+		peak = max(peak, c)
+	}
+	var b strings.Builder
+	for _, c := range counts {
+		i := 0
+		if peak > 0 {
+			i = c * (len(sparks) - 1) / peak
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
+
+// truncate cuts s to width runes, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width || width < 1 {
+		return s
+	}
+	return string([]rune(s)[:width-1]) + "…"
+}
+
+// pad fills s with spaces to cols runes, so inverse bars span the screen
+func pad(s string, cols int) string {
+	if n := len([]rune(s)); n < cols {
+		return s + strings.Repeat(" ", cols-n)
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+package tui
+
+import (
+	"accessAggregator/internal/accesslog"
+	"accessAggregator/internal/sink"
+	"bytes"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+var epoch = time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+
+var ansi = regexp.MustCompile(`\033\[[0-9;?]*[a-zA-Z]`)
+
+// screen is the last frame drawn, without escape sequences
+func screen(buf *bytes.Buffer) []string {
+	frames := strings.Split(buf.String(), home)
+	return strings.Split(ansi.ReplaceAllString(frames[len(frames)-1], ""), "\r\n")
+}
+
+// hostOrder returns the hosts in table order
+func hostOrder(lines []string) []string {
+	var hosts []string
+	for _, l := range lines[2:] {
+		if f := strings.Fields(l); len(f) == 6 && strings.HasSuffix(f[0], ".com") {
+			hosts = append(hosts, f[0])
+		}
+	}
+	return hosts
+}
+
+func snap(at time.Time, rows ...accesslog.Row) sink.Snapshot {
+	return sink.Snapshot{Time: at, Rows: rows, Inputs: []sink.InputStats{{Name: "access.log", State: "tailing", Dropped: 3}}}
+}
+
+func newTestDashboard() (*Dashboard, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return New(&buf, func() (int, int) { return 100, 20 }, accesslog.View{Sort: accesslog.SortTotal, Desc: true}), &buf
+}
+
+func TestDashboard_SortAndFilter(t *testing.T) {
+	d, buf := newTestDashboard()
+	d.Update(snap(epoch,
+		accesslog.Row{Host: "a.com", Requests: 5, Requests2xx: 5, DurationTotal: 5},
+		accesslog.Row{Host: "b.com", Requests: 50, Requests2xx: 10, DurationTotal: 5},
+		accesslog.Row{Host: "api.com", Requests: 20, Requests2xx: 20, DurationTotal: 1},
+	))
+
+	steps := []struct {
+		keys string
+		want []string
+	}{
+		{"", []string{"b.com", "api.com", "a.com"}}, // total, largest first
+		{"2", []string{"a.com", "api.com", "b.com"}},
+		{"1", []string{"a.com", "api.com", "b.com"}},
+		{"1", []string{"b.com", "api.com", "a.com"}},
+		{"5", []string{"a.com", "b.com", "api.com"}},
+		{"4", []string{"b.com", "a.com", "api.com"}},
+		{"/a\r", []string{"a.com", "api.com"}},
+		{"/ap\x7f\x7fb", []string{"b.com"}},
+		{"\x1b", []string{"b.com", "a.com", "api.com"}},
+	}
+	for _, st := range steps {
+		for _, k := range []byte(st.keys) {
+			if d.Key(k) {
+				t.Fatalf("key %q quit", k)
+			}
+		}
+		if got := hostOrder(screen(buf)); strings.Join(got, " ") != strings.Join(st.want, " ") {
+			t.Errorf("after %q hosts = %v, want %v", st.keys, got, st.want)
+		}
+	}
+	if !d.Key('q') {
+		t.Error("q did not quit")
+	}
+}
+
+func TestDashboard_PauseSparklineAndStatus(t *testing.T) {
+	d, buf := newTestDashboard()
+	for i, n := range []int{10, 30, 60, 70} {
+		d.Update(snap(epoch.Add(time.Duration(i)*10*time.Second), accesslog.Row{Host: "a.com", Requests: n, DurationTotal: 1}))
+	}
+
+	frame := strings.Join(screen(buf), "\n")
+	// per tick 10, 20, 30, 10 requests
+	if !strings.Contains(frame, "▃▅█▃") {
+		t.Errorf("missing sparkline:\n%s", frame)
+	}
+	if !strings.Contains(frame, "access.log tailing dropped 3") {
+		t.Errorf("missing input status:\n%s", frame)
+	}
+
+	d.Key('p')
+	d.Update(snap(epoch.Add(time.Minute), accesslog.Row{Host: "a.com", Requests: 99, DurationTotal: 1}))
+	frame = strings.Join(screen(buf), "\n")
+	if !strings.Contains(frame, "PAUSED") || !strings.Contains(frame, "02:07:30") || strings.Contains(frame, " 99 ") {
+		t.Errorf("paused view moved on:\n%s", frame)
+	}
+
+	d.Key('p')
+	frame = strings.Join(screen(buf), "\n")
+	if !strings.Contains(frame, "02:08:00") || !strings.Contains(frame, " 99 ") {
+		t.Errorf("resume did not show the latest tick:\n%s", frame)
+	}
+}
+
+func TestDashboard_TruncatesToScreen(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, func() (int, int) { return 80, 10 }, accesslog.View{})
+	var rows []accesslog.Row
+	for _, h := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		rows = append(rows, accesslog.Row{Host: h + ".com", Requests: 1, DurationTotal: 1})
+	}
+	d.Update(snap(epoch, rows...))
+
+	lines := screen(&buf)
+	if len(lines) != 10 {
+		t.Errorf("frame has %d lines, want the 10 of the terminal", len(lines))
+	}
+	if !strings.Contains(strings.Join(lines, "\n"), "... 6 more hosts") {
+		t.Errorf("missing overflow line:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestDashboard_ForgetsEvictedHosts(t *testing.T) {
+	d, _ := newTestDashboard()
+	d.Update(snap(epoch, accesslog.Row{Host: "a.com", Requests: 5}, accesslog.Row{Host: "b.com", Requests: 2}))
+	d.Update(snap(epoch.Add(10*time.Second), accesslog.Row{Host: "b.com", Requests: 3}))
+	if _, ok := d.history["a.com"]; ok || len(d.last) != 1 {
+		t.Errorf("dashboard kept evicted host: last %v, history %v", d.last, d.history)
+	}
+}
+
+func TestDashboard_TruncatesByRune(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, func() (int, int) { return 30, 10 }, accesslog.View{})
+	d.Update(snap(epoch, accesslog.Row{Host: strings.Repeat("ü", 20) + ".com", Requests: 1, DurationTotal: 1}))
+
+	frame := strings.Join(screen(&buf), "\n")
+	if !utf8.ValidString(frame) || !strings.Contains(frame, strings.Repeat("ü", 9)+"…") {
+		t.Errorf("host not cut on a rune boundary:\n%s", frame)
+	}
+}
+
+func TestDashboard_CutsLinesToWidth(t *testing.T) {
+	var buf bytes.Buffer
+	d := New(&buf, func() (int, int) { return 30, 10 }, accesslog.View{})
+	d.Update(snap(epoch, accesslog.Row{Host: "a.com", Requests: 12345, DurationTotal: 1}))
+	d.Update(snap(epoch.Add(10*time.Second), accesslog.Row{Host: "a.com", Requests: 23456, DurationTotal: 2}))
+
+	for _, l := range screen(&buf) {
+		if n := utf8.RuneCountInString(l); n > 30 {
+			t.Errorf("line of %d runes wraps a 30 column terminal: %q", n, l)
+		}
+	}
+}
+
+func TestDashboard_SetError(t *testing.T) {
+	d, buf := newTestDashboard()
+	d.Update(snap(epoch))
+	d.SetError(`level=ERROR msg="input failed"`)
+	if frame := strings.Join(screen(buf), "\n"); !strings.Contains(frame, `msg="input failed"`) {
+		t.Errorf("status bar missing the error:\n%s", frame)
+	}
+}
+
+func TestDashboard_View(t *testing.T) {
+	var buf bytes.Buffer
+	view := accesslog.View{Sort: accesslog.SortErrors, Desc: true, Top: 2, Columns: []string{"total", "5xx"}}
+	d := New(&buf, func() (int, int) { return 100, 20 }, view)
+	d.Update(snap(epoch,
+		accesslog.Row{Host: "a.com", Requests: 50, ByClass: [6]int{5: 1}},
+		accesslog.Row{Host: "b.com", Requests: 5, ByClass: [6]int{5: 3}},
+		accesslog.Row{Host: "c.com", Requests: 9, ByClass: [6]int{5: 2}},
+	))
+
+	lines := screen(&buf)
+	if f := strings.Fields(lines[1]); strings.Join(f, " ") != "host total 5xx▼ rate" {
+		t.Errorf("header = %q, want the View's columns sorted by 5xx", lines[1])
+	}
+	// host and values, without the sparkline
+	cells := func(lines []string) []string {
+		var got []string
+		for _, l := range lines[2:5] {
+			got = append(got, strings.Join(strings.Fields(l)[:3], " "))
+		}
+		return got
+	}
+	want := []string{"b.com 5 3", "c.com 9 2", accesslog.OthersRow + " 50 1"}
+	if got := cells(lines); !slices.Equal(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+
+	// keys pick among the shown columns
+	d.Key('2')
+	want = []string{"a.com 50 1", "c.com 9 2", accesslog.OthersRow + " 5 3"}
+	if got := cells(screen(&buf)); !slices.Equal(got, want) {
+		t.Errorf("after sorting by total rows = %q, want %q", got, want)
+	}
+}
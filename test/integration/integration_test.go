@@ -4,8 +4,10 @@ package integration_test
 import (
 	"accessAggregator/internal/app"
 	"accessAggregator/internal/config"
+	"accessAggregator/internal/sink"
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"path/filepath"
@@ -150,7 +152,7 @@ func TestNonExistentFile(t *testing.T) {
 	if !strings.Contains(errOut.String(), "does-not-exist.log") {
 		t.Error("Expected filename in error output")
 	}
-	if !strings.Contains(errOut.String(), "error:") {
+	if !strings.Contains(errOut.String(), "level=ERROR") {
 		t.Error("Expected error message")
 	}
 }
@@ -544,3 +546,134 @@ func TestGracefulShutdown(t *testing.T) {
 		t.Error("Record not drained before exit")
 	}
 }
+
+// test the json sink receives the final snapshot
+func TestJSONSink(t *testing.T) {
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "test.log")
+	sinkFile := filepath.Join(tmpDir, "summary.jsonl")
+
+	content := `{"time":"2025-08-14T02:07:12.680651416Z","host":"chatgpt.com","status_code":200,"duration":0.224}
+{"time":"2025-08-14T02:07:13.680651416Z","host":"github.com","status_code":404,"duration":0.150}
+`
+	if err := os.WriteFile(logFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+
+	flags := config.Flags{
+		Files:     []string{logFile},
+		FromStart: true,
+		Interval:  time.Hour,
+		Sinks:     []sink.Spec{{Kind: "json", Target: sinkFile}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(ctx, flags, io.Discard, io.Discard)
+	}()
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Test timeout")
+	}
+
+	raw, err := os.ReadFile(sinkFile)
+	if err != nil {
+		t.Fatalf("sink file not written: %v", err)
+	}
+	var snap sink.Snapshot
+	if err := json.Unmarshal(bytes.TrimSpace(raw), &snap); err != nil {
+		t.Fatalf("sink output is not one JSON snapshot: %v\n%s", err, raw)
+	}
+	if !snap.Final || len(snap.Rows) != 2 || snap.Rows[0].Host != "chatgpt.com" || snap.Rows[1].Requests2xx != 0 {
+		t.Errorf("unexpected final snapshot: %+v", snap)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tmpDir := t.TempDir()
+	logFile := filepath.Join(tmpDir, "old.log")
+	sinkFile := filepath.Join(tmpDir, "summary.jsonl")
+
+	var content strings.Builder
+	start := time.Date(2025, 8, 14, 2, 7, 0, 0, time.UTC)
+	for _, sec := range []int{0, 5, 15, 25, 26, 41} {
+		content.WriteString(`{"time":"` + start.Add(time.Duration(sec)*time.Second).Format(time.RFC3339) +
+			`","host":"a.com","status_code":200,"duration":0.1}` + "\n")
+	}
+	if err := os.WriteFile(logFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+
+	flags := config.Flags{
+		Files:    []string{logFile},
+		Interval: 10 * time.Second,
+		Sinks:    []sink.Spec{{Kind: "json", Target: sinkFile}},
+		Replay:   true, // as fast as possible, ends with the file
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(context.Background(), flags, io.Discard, io.Discard)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("replay did not end with the file")
+	}
+
+	raw, err := os.ReadFile(sinkFile)
+	if err != nil {
+		t.Fatalf("sink file not written: %v", err)
+	}
+	type tick struct {
+		at       int
+		requests int
+	}
+	var got []tick
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var snap sink.Snapshot
+		if err := json.Unmarshal([]byte(line), &snap); err != nil {
+			t.Fatalf("invalid snapshot %q: %v", line, err)
+		}
+		requests := 0
+		for _, r := range snap.Rows {
+			requests += r.Requests
+		}
+		got = append(got, tick{int(snap.Time.Sub(start).Seconds()), requests})
+	}
+	// ticks every 10s of record time, the final one at the last record
+	want := []tick{{10, 2}, {20, 3}, {30, 5}, {40, 5}, {41, 6}}
+	if len(got) != len(want) {
+		t.Fatalf("ticks = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ticks = %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestReplay_MissingFile(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "missing.log")
+	flags := config.Flags{
+		Files:    []string{logFile},
+		Interval: 10 * time.Second,
+		Replay:   true,
+	}
+	err := app.Run(context.Background(), flags, io.Discard, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), logFile) {
+		t.Errorf("Run() error = %v, want the open error of %s", err, logFile)
+	}
+}